@@ -20,7 +20,7 @@ type barkMessageResponse struct {
 	Message string `json:"message"`
 }
 
-func SendBarkMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+func buildBarkPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
 	url := fmt.Sprintf("%s/%s", channel_.URL, channel_.Secret)
 	req := barkMessageRequest{
 		Title: message.Title,
@@ -30,14 +30,23 @@ func SendBarkMessage(message *model.Message, user *model.User, channel_ *model.C
 	if message.Content == "" {
 		req.Body = message.Description
 	}
-	reqBody, err := json.Marshal(req)
+	return &Payload{Method: http.MethodPost, URL: url, Body: req}, nil
+}
+
+func SendBarkMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildBarkPayload(message, user, channel_)
 	if err != nil {
 		return err
 	}
-	resp, err := http.Post(url, "application/json", bytes.NewReader(reqBody))
+	reqBody, err := payload.bodyBytes()
 	if err != nil {
 		return err
 	}
+	resp, err := getHTTPClient(channel_).Post(payload.URL, "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 	var res barkMessageResponse
 	err = json.NewDecoder(resp.Body).Decode(&res)
 	if err != nil {
@@ -48,3 +57,15 @@ func SendBarkMessage(message *model.Message, user *model.User, channel_ *model.C
 	}
 	return nil
 }
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeBark,
+		schema: []ConfigField{
+			{Column: ColumnURL, Type: FieldTypeURL, Label: "服务器地址", Required: true},
+			{Column: ColumnSecret, Type: FieldTypeSecret, Label: "推送 key", Required: true},
+		},
+		send:    SendBarkMessage,
+		preview: buildBarkPayload,
+	})
+}
@@ -162,3 +162,13 @@ func SendClientMessage(message *model.Message, user *model.User, channel_ *model
 	client.sendMessage(message)
 	return nil
 }
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeClient,
+		schema: []ConfigField{
+			{Column: ColumnSecret, Type: FieldTypeSecret, Label: "客户端连接密钥", Required: true},
+		},
+		send: SendClientMessage,
+	})
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"message-pusher/model"
 	"net/http"
 	"strings"
@@ -26,7 +25,7 @@ type corpMessageResponse struct {
 	Message string `json:"errmsg"`
 }
 
-func SendCorpMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+func buildCorpPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
 	// https://developer.work.weixin.qq.com/document/path/91770
 	messageRequest := corpMessageRequest{
 		MessageType: "text",
@@ -41,15 +40,24 @@ func SendCorpMessage(message *model.Message, user *model.User, channel_ *model.C
 	if message.To != "" {
 		messageRequest.MentionedList = strings.Split(message.To, "|")
 	}
-	jsonData, err := json.Marshal(messageRequest)
+	return &Payload{Method: http.MethodPost, URL: channel_.URL, Body: messageRequest}, nil
+}
+
+func SendCorpMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildCorpPayload(message, user, channel_)
 	if err != nil {
 		return err
 	}
-	resp, err := http.Post(fmt.Sprintf("%s", channel_.URL), "application/json",
+	jsonData, err := payload.bodyBytes()
+	if err != nil {
+		return err
+	}
+	resp, err := getHTTPClient(channel_).Post(payload.URL, "application/json",
 		bytes.NewBuffer(jsonData))
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	var res corpMessageResponse
 	err = json.NewDecoder(resp.Body).Decode(&res)
 	if err != nil {
@@ -60,3 +68,14 @@ func SendCorpMessage(message *model.Message, user *model.User, channel_ *model.C
 	}
 	return nil
 }
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeCorp,
+		schema: []ConfigField{
+			{Column: ColumnURL, Type: FieldTypeURL, Label: "Webhook 地址", Required: true},
+		},
+		send:    SendCorpMessage,
+		preview: buildCorpPayload,
+	})
+}
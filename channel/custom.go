@@ -2,6 +2,7 @@ package channel
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"os"
@@ -11,7 +12,7 @@ import (
 	"message-pusher/model"
 )
 
-func SendCustomMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+func validateCustomChannel(channel_ *model.Channel) error {
 	url := channel_.URL
 	if strings.HasPrefix(url, "http:") && os.Getenv("CHANNEL_URL_ALLOW_NON_HTTPS") != "true" {
 		return errors.New("自定义通道必须使用 HTTPS 协议")
@@ -19,14 +20,42 @@ func SendCustomMessage(message *model.Message, user *model.User, channel_ *model
 	if strings.HasPrefix(url, common.ServerAddress) {
 		return errors.New("自定义通道不能使用本服务地址")
 	}
+	return nil
+}
+
+func buildCustomPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
+	err := validateCustomChannel(channel_)
+	if err != nil {
+		return nil, err
+	}
 	template := channel_.Other
 	template = common.Replace(template, "$url", message.URL, -1)
 	template = common.Replace(template, "$to", message.To, -1)
 	template = common.Replace(template, "$title", message.Title, -1)
 	template = common.Replace(template, "$description", message.Description, -1)
 	template = common.Replace(template, "$content", message.Content, -1)
-	reqBody := []byte(template)
-	resp, err := http.Post(url, "application/json", bytes.NewReader(reqBody))
+	payload := &Payload{Method: http.MethodPost, URL: channel_.URL, Body: template}
+	if json.Valid([]byte(template)) {
+		payload.Body = json.RawMessage(template)
+	}
+	return payload, nil
+}
+
+func SendCustomMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildCustomPayload(message, user, channel_)
+	if err != nil {
+		return err
+	}
+	reqBody, err := payload.bodyBytes()
+	if err != nil {
+		return err
+	}
+	resp, err := getHTTPClient(channel_).Post(payload.URL, "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = checkResponseStatus(resp)
 	if err != nil {
 		return err
 	}
@@ -35,3 +64,16 @@ func SendCustomMessage(message *model.Message, user *model.User, channel_ *model
 	}
 	return nil
 }
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeCustom,
+		schema: []ConfigField{
+			{Column: ColumnURL, Type: FieldTypeURL, Label: "请求地址", Required: true},
+			{Column: ColumnOther, Type: FieldTypeJSON, Label: "请求体", Required: true},
+		},
+		send:     SendCustomMessage,
+		validate: validateCustomChannel,
+		preview:  buildCustomPayload,
+	})
+}
@@ -30,12 +30,15 @@ type dingMessageRequest struct {
 	}
 }
 
+// https://open.dingtalk.com/document/orgapp/server-api-error-codes-1
+const dingErrorCodeSendTooFast = 130101
+
 type dingMessageResponse struct {
 	Code    int    `json:"errcode"`
 	Message string `json:"errmsg"`
 }
 
-func SendDingMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+func buildDingPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
 	// https://open.dingtalk.com/document/robots/custom-robot-access#title-72m-8ag-pqw
 	messageRequest := dingMessageRequest{
 		MessageType: "text",
@@ -58,23 +61,47 @@ func SendDingMessage(message *model.Message, user *model.User, channel_ *model.C
 
 	timestamp := time.Now().UnixMilli()
 	sign, err := dingSign(channel_.Secret, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	return &Payload{
+		Method: http.MethodPost,
+		URL:    fmt.Sprintf("%s&timestamp=%d&sign=%s", channel_.URL, timestamp, sign),
+		Body:   messageRequest,
+	}, nil
+}
+
+func SendDingMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildDingPayload(message, user, channel_)
 	if err != nil {
 		return err
 	}
-	jsonData, err := json.Marshal(messageRequest)
+	jsonData, err := payload.bodyBytes()
 	if err != nil {
 		return err
 	}
-	resp, err := http.Post(fmt.Sprintf("%s&timestamp=%d&sign=%s", channel_.URL, timestamp, sign), "application/json",
+	resp, err := getHTTPClient(channel_).Post(payload.URL, "application/json",
 		bytes.NewBuffer(jsonData))
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	err = checkResponseStatus(resp)
+	if err != nil {
+		return err
+	}
 	var res dingMessageResponse
 	err = json.NewDecoder(resp.Body).Decode(&res)
 	if err != nil {
 		return err
 	}
+	if res.Code == dingErrorCodeSendTooFast {
+		return &SendError{
+			StatusCode: resp.StatusCode,
+			Retryable:  true,
+			Err:        errors.New(res.Message),
+		}
+	}
 	if res.Code != 0 {
 		return errors.New(res.Message)
 	}
@@ -94,3 +121,15 @@ func dingSign(secret string, timestamp int64) (string, error) {
 	signature = url.QueryEscape(signature)
 	return signature, nil
 }
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeDing,
+		schema: []ConfigField{
+			{Column: ColumnURL, Type: FieldTypeURL, Label: "Webhook 地址", Required: true},
+			{Column: ColumnSecret, Type: FieldTypeSecret, Label: "签名校验密钥", Required: false},
+		},
+		send:    SendDingMessage,
+		preview: buildDingPayload,
+	})
+}
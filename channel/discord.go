@@ -18,7 +18,7 @@ type discordMessageResponse struct {
 	Message string `json:"message"`
 }
 
-func SendDiscordMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+func buildDiscordPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
 	if message.Content == "" {
 		message.Content = message.Description
 	}
@@ -34,12 +34,24 @@ func SendDiscordMessage(message *model.Message, user *model.User, channel_ *mode
 		}
 		messageRequest.Content = messageRequest.Content + message.Content
 	}
+	return &Payload{Method: http.MethodPost, URL: channel_.URL, Body: messageRequest}, nil
+}
 
-	jsonData, err := json.Marshal(messageRequest)
+func SendDiscordMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildDiscordPayload(message, user, channel_)
+	if err != nil {
+		return err
+	}
+	jsonData, err := payload.bodyBytes()
 	if err != nil {
 		return err
 	}
-	resp, err := http.Post(channel_.URL, "application/json", bytes.NewBuffer(jsonData))
+	resp, err := getHTTPClient(channel_).Post(payload.URL, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = checkResponseStatus(resp)
 	if err != nil {
 		return err
 	}
@@ -59,3 +71,14 @@ func SendDiscordMessage(message *model.Message, user *model.User, channel_ *mode
 	}
 	return nil
 }
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeDiscord,
+		schema: []ConfigField{
+			{Column: ColumnURL, Type: FieldTypeURL, Label: "Webhook 地址", Required: true},
+		},
+		send:    SendDiscordMessage,
+		preview: buildDiscordPayload,
+	})
+}
@@ -0,0 +1,304 @@
+package channel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"message-pusher/model"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Columns of model.Channel a driver can store its config in.
+const (
+	ColumnSecret    = "secret"
+	ColumnAppId     = "app_id"
+	ColumnAccountId = "account_id"
+	ColumnURL       = "url"
+	ColumnOther     = "other"
+)
+
+const (
+	FieldTypeString  = "string"
+	FieldTypeSecret  = "secret"
+	FieldTypeURL     = "url"
+	FieldTypeJSON    = "json"
+	FieldTypeOptions = "options"
+)
+
+// ConfigField describes what a driver stores in one column of model.Channel.
+type ConfigField struct {
+	Column   string   `json:"column"`
+	Type     string   `json:"type"`
+	Label    string   `json:"label"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options,omitempty"`
+}
+
+// Driver knows how to validate a channel's config and deliver messages through it.
+// Drivers register themselves in init(), so adding a channel type never touches SendMessage.
+type Driver interface {
+	Type() string
+	Schema() []ConfigField
+	Validate(channel_ *model.Channel) error
+	Send(message *model.Message, user *model.User, channel_ *model.Channel) error
+	Test(user *model.User, channel_ *model.Channel) error
+	Preview(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error)
+}
+
+type SendFunc func(message *model.Message, user *model.User, channel_ *model.Channel) error
+
+type PreviewFunc func(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error)
+
+// Payload is the HTTP request a driver sends for a message, dry runs return it instead of sending.
+type Payload struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Body   interface{} `json:"body,omitempty"` // marshaled as JSON unless it's a string or json.RawMessage
+}
+
+func (p *Payload) bodyBytes() ([]byte, error) {
+	switch body := p.Body.(type) {
+	case string:
+		return []byte(body), nil
+	case json.RawMessage:
+		return body, nil
+	}
+	return json.Marshal(p.Body)
+}
+
+// driver is the Driver implementation shared by all built-in channel types.
+type driver struct {
+	type_    string
+	schema   []ConfigField
+	send     SendFunc
+	validate func(channel_ *model.Channel) error // optional, runs after the schema check
+	test     func(user *model.User, channel_ *model.Channel) error
+	preview  PreviewFunc // optional, builds the request without sending it
+}
+
+func (d *driver) Type() string {
+	return d.type_
+}
+
+func (d *driver) Schema() []ConfigField {
+	return d.schema
+}
+
+func (d *driver) Validate(channel_ *model.Channel) error {
+	err := validateSchema(channel_, d.schema)
+	if err != nil {
+		return err
+	}
+	if d.validate != nil {
+		return d.validate(channel_)
+	}
+	return nil
+}
+
+func (d *driver) Send(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	return d.send(message, user, channel_)
+}
+
+func (d *driver) Test(user *model.User, channel_ *model.Channel) error {
+	if d.test != nil {
+		return d.test(user, channel_)
+	}
+	message := &model.Message{
+		Title:       "测试消息",
+		Description: "这是一条测试消息",
+		Content:     fmt.Sprintf("如果你收到了这条消息，说明消息通道「%s」配置正确。", channel_.Name),
+		Channel:     channel_.Name,
+	}
+	return d.send(message, user, channel_)
+}
+
+func (d *driver) Preview(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
+	if d.preview == nil {
+		return nil, errors.New("该类型的消息通道暂不支持预览请求内容")
+	}
+	payload, err := d.preview(message, user, channel_)
+	if err != nil {
+		return nil, err
+	}
+	// Webhook URLs carry their tokens in the query or path, e.g. DingTalk and Lark.
+	payload.URL = maskURL(payload.URL)
+	// Some channels put their secret in the URL, e.g. Telegram and Bark, and some in the body, e.g. Pushover.
+	if channel_.Secret != "" {
+		payload.URL = strings.ReplaceAll(payload.URL, channel_.Secret, "******")
+		if body, ok := payload.Body.(string); ok {
+			payload.Body = strings.ReplaceAll(body, channel_.Secret, "******")
+		} else if body, err := payload.bodyBytes(); err == nil {
+			payload.Body = json.RawMessage(strings.ReplaceAll(string(body), channel_.Secret, "******"))
+		}
+	}
+	return payload, nil
+}
+
+// sensitiveQueryKeys are the query parameters masked in previews.
+var sensitiveQueryKeys = []string{"access_token", "token", "key", "secret", "sign", "sig", "signature", "password", "code"}
+
+// tokenPathSegmentRegex matches the path segments looking like tokens,
+// e.g. the hook of Lark, DingTalk's access token or the token of Discord and Slack webhooks.
+var tokenPathSegmentRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{20,}$`)
+
+// maskURL masks the credentials in rawURL, so that previews can be shared.
+func maskURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "******")
+	}
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		if tokenPathSegmentRegex.MatchString(segment) {
+			segments[i] = "******"
+		}
+	}
+	u.Path = strings.Join(segments, "/")
+	u.RawPath = ""
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			for _, sensitiveKey := range sensitiveQueryKeys {
+				if strings.EqualFold(key, sensitiveKey) {
+					query.Set(key, "******")
+				}
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return strings.ReplaceAll(u.String(), "%2A%2A%2A%2A%2A%2A", "******")
+}
+
+var drivers = make(map[string]Driver)
+var driversMutex sync.RWMutex
+
+// RegisterDriver panics on duplicate types, it's meant to be called from init().
+func RegisterDriver(d Driver) {
+	driversMutex.Lock()
+	defer driversMutex.Unlock()
+	if _, ok := drivers[d.Type()]; ok {
+		panic("channel driver registered twice: " + d.Type())
+	}
+	drivers[d.Type()] = d
+}
+
+func GetDriver(type_ string) (Driver, error) {
+	driversMutex.RLock()
+	defer driversMutex.RUnlock()
+	d, ok := drivers[type_]
+	if !ok {
+		return nil, errors.New("不支持的消息通道：" + type_)
+	}
+	return d, nil
+}
+
+type DriverInfo struct {
+	Type   string        `json:"type"`
+	Schema []ConfigField `json:"schema"`
+}
+
+func GetDriverInfos() []DriverInfo {
+	driversMutex.RLock()
+	defer driversMutex.RUnlock()
+	infos := make([]DriverInfo, 0, len(drivers))
+	for _, d := range drivers {
+		infos = append(infos, DriverInfo{Type: d.Type(), Schema: d.Schema()})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Type < infos[j].Type
+	})
+	return infos
+}
+
+func ValidateChannel(channel_ *model.Channel) error {
+	d, err := GetDriver(channel_.Type)
+	if err != nil {
+		return err
+	}
+	err = validateRetryPolicy(channel_.RetryPolicy)
+	if err != nil {
+		return err
+	}
+	if channel_.Proxy != "" {
+		_, err = ParseProxyURL(channel_.Proxy)
+		if err != nil {
+			return err
+		}
+	}
+	return d.Validate(channel_)
+}
+
+func TestChannel(user *model.User, channel_ *model.Channel) error {
+	d, err := GetDriver(channel_.Type)
+	if err != nil {
+		return err
+	}
+	return d.Test(user, channel_)
+}
+
+func getChannelColumn(channel_ *model.Channel, column string) string {
+	switch column {
+	case ColumnSecret:
+		return channel_.Secret
+	case ColumnAppId:
+		return channel_.AppId
+	case ColumnAccountId:
+		return channel_.AccountId
+	case ColumnURL:
+		return channel_.URL
+	case ColumnOther:
+		return channel_.Other
+	}
+	return ""
+}
+
+func validateSchema(channel_ *model.Channel, schema []ConfigField) error {
+	for _, field := range schema {
+		value := getChannelColumn(channel_, field.Column)
+		if value == "" {
+			if field.Required {
+				return fmt.Errorf("%s不能为空", field.Label)
+			}
+			continue
+		}
+		switch field.Type {
+		case FieldTypeURL:
+			u, err := url.Parse(value)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("%s不是合法的 HTTP(S) 地址", field.Label)
+			}
+		case FieldTypeJSON:
+			if !json.Valid([]byte(value)) {
+				return fmt.Errorf("%s不是合法的 JSON", field.Label)
+			}
+		case FieldTypeOptions:
+			valid := false
+			for _, option := range field.Options {
+				if value == option {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				return fmt.Errorf("%s的取值无效：%s", field.Label, value)
+			}
+		}
+	}
+	return nil
+}
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeNone,
+		send: func(message *model.Message, user *model.User, channel_ *model.Channel) error {
+			return nil
+		},
+	})
+}
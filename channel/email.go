@@ -8,15 +8,22 @@ import (
 	"strings"
 )
 
-func SendEmailMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+type emailMessage struct {
+	Subject string `json:"subject"`
+	To      string `json:"to"`
+	Content string `json:"content"` // HTML
+}
+
+func buildEmailPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
+	to := user.Email
 	if message.To != "" {
 		if user.SendEmailToOthers != common.SendEmailToOthersAllowed && user.Role < common.RoleAdminUser {
-			return errors.New("没有权限发送邮件给其他人，请联系管理员为你添加该权限")
+			return nil, errors.New("没有权限发送邮件给其他人，请联系管理员为你添加该权限")
 		}
-		user.Email = message.To
+		to = message.To
 	}
-	if user.Email == "" {
-		return errors.New("未配置邮箱地址")
+	if to == "" {
+		return nil, errors.New("未配置邮箱地址")
 	}
 	subject := message.Title
 	content := message.Content
@@ -30,6 +37,27 @@ func SendEmailMessage(message *model.Message, user *model.User, channel_ *model.
 	if err != nil {
 		common.SysLog(err.Error())
 	}
-	user.Email = strings.ReplaceAll(user.Email, "|", ";")
-	return common.SendEmail(subject, user.Email, message.HTMLContent)
+	to = strings.ReplaceAll(to, "|", ";")
+	return &Payload{Method: "SMTP", URL: "mailto:" + to, Body: emailMessage{
+		Subject: subject,
+		To:      to,
+		Content: message.HTMLContent,
+	}}, nil
+}
+
+func SendEmailMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildEmailPayload(message, user, channel_)
+	if err != nil {
+		return err
+	}
+	email := payload.Body.(emailMessage)
+	return common.SendEmail(email.Subject, email.To, email.Content)
+}
+
+func init() {
+	RegisterDriver(&driver{
+		type_:   model.TypeEmail,
+		send:    SendEmailMessage,
+		preview: buildEmailPayload,
+	})
 }
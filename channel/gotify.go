@@ -0,0 +1,105 @@
+package channel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"message-pusher/model"
+	"net/http"
+	"strings"
+)
+
+// gotifyPriorities maps the message priorities to Gotify's 0-10,
+// the Android client plays a sound from 4 and pops up the notification from 8.
+var gotifyPriorities = map[int]int{1: 1, 2: 3, 3: 5, 4: 8, 5: 10}
+
+type gotifyMessageRequest struct {
+	Title    string                 `json:"title,omitempty"`
+	Message  string                 `json:"message"`
+	Priority *int                   `json:"priority,omitempty"` // the app's default priority is used if not set
+	Extras   map[string]interface{} `json:"extras,omitempty"`
+}
+
+type gotifyMessageResponse struct {
+	Id               int    `json:"id"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"errorDescription"`
+}
+
+func buildGotifyPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
+	// https://gotify.net/docs/msgextras
+	req := gotifyMessageRequest{
+		Title:   message.Title,
+		Message: message.Content,
+		Extras:  map[string]interface{}{},
+	}
+	if req.Message == "" {
+		req.Message = message.Description
+	}
+	if req.Message == "" {
+		// the message is required by Gotify
+		req.Message = message.Title
+	}
+	if priority, ok := gotifyPriorities[message.Priority]; ok {
+		req.Priority = &priority
+	}
+	if message.RenderMode != "raw" {
+		req.Extras["client::display"] = map[string]string{"contentType": "text/markdown"}
+	}
+	if message.URL != "" {
+		req.Extras["client::notification"] = map[string]interface{}{
+			"click": map[string]string{"url": message.URL},
+		}
+	}
+	url := fmt.Sprintf("%s/message", strings.TrimSuffix(channel_.URL, "/"))
+	return &Payload{Method: http.MethodPost, URL: url, Body: req}, nil
+}
+
+func SendGotifyMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildGotifyPayload(message, user, channel_)
+	if err != nil {
+		return err
+	}
+	reqBody, err := payload.bodyBytes()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(payload.Method, payload.URL, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", channel_.Secret)
+	resp, err := getHTTPClient(channel_).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = checkResponseStatus(resp)
+	if err != nil {
+		return err
+	}
+	var res gotifyMessageResponse
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return err
+	}
+	if res.Error != "" {
+		return errors.New(res.Error + ": " + res.ErrorDescription)
+	}
+	message.RemoteId = fmt.Sprintf("%d", res.Id)
+	return nil
+}
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeGotify,
+		schema: []ConfigField{
+			{Column: ColumnURL, Type: FieldTypeURL, Label: "服务器地址", Required: true},
+			{Column: ColumnSecret, Type: FieldTypeSecret, Label: "应用 Token", Required: true},
+		},
+		send:    SendGotifyMessage,
+		preview: buildGotifyPayload,
+	})
+}
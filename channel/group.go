@@ -3,10 +3,51 @@ package channel
 import (
 	"errors"
 	"fmt"
+	"message-pusher/common"
 	"message-pusher/model"
 	"strings"
 )
 
+func validateGroupChannel(channel_ *model.Channel) error {
+	subChannels := strings.Split(channel_.AppId, "|")
+	if len(subChannels) != len(strings.Split(channel_.AccountId, "|")) {
+		return errors.New("无效的群组消息配置，子通道数量与子目标数量不一致")
+	}
+	for _, name := range subChannels {
+		if name == channel_.Name {
+			return errors.New("群组消息子通道不能是其自身")
+		}
+		subChannel, err := model.GetChannelByName(name, channel_.UserId)
+		if err != nil {
+			return errors.New("群组消息子通道不存在：" + name)
+		}
+		if subChannel.Type == model.TypeGroup {
+			return errors.New("群组消息子通道不能是群组消息")
+		}
+	}
+	return nil
+}
+
+// PartialSendError means some sub channels of a group message succeeded while the others failed.
+type PartialSendError struct {
+	Failed int
+	Total  int
+	Err    error
+}
+
+func (e *PartialSendError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PartialSendError) Unwrap() error {
+	return e.Err
+}
+
+func IsPartialSendError(err error) bool {
+	var partialErr *PartialSendError
+	return errors.As(err, &partialErr)
+}
+
 func SendGroupMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
 	subChannels := strings.Split(channel_.AppId, "|")
 	var subTargets []string
@@ -18,8 +59,29 @@ func SendGroupMessage(message *model.Message, user *model.User, channel_ *model.
 	if len(subChannels) != len(subTargets) {
 		return errors.New("无效的群组消息配置，子通道数量与子目标数量不一致")
 	}
+	// Sub channels succeeded before (e.g. the async message is reloaded) won't be sent again.
+	sent := make(map[string]bool)
+	if message.Id != 0 {
+		deliveries, err := model.GetMessageDeliveriesByMessageId(message.Id)
+		if err != nil {
+			return err
+		}
+		for _, delivery := range deliveries {
+			if delivery.Status == common.MessageSendStatusSent {
+				sent[delivery.Channel+"|"+delivery.Target] = true
+			}
+		}
+	}
+	originalTo, originalChannel := message.To, message.Channel
+	defer func() {
+		message.To, message.Channel = originalTo, originalChannel
+	}()
 	errMessage := ""
+	failed := 0
 	for i := 0; i < len(subChannels); i++ {
+		if sent[subChannels[i]+"|"+subTargets[i]] {
+			continue
+		}
 		message.To = subTargets[i]
 		message.Channel = subChannels[i]
 		subChannel, err := model.GetChannelByName(subChannels[i], user.Id)
@@ -29,13 +91,80 @@ func SendGroupMessage(message *model.Message, user *model.User, channel_ *model.
 		if subChannel.Type == model.TypeGroup {
 			return errors.New("群组消息子通道不能是群组消息")
 		}
-		err = SendMessage(message, user, subChannel)
+		err = SendMessageWithRetry(message, user, subChannel)
 		if err != nil {
+			failed++
 			errMessage += fmt.Sprintf("发送群组消息子通道 %s 失败：%s\n", subChannels[i], err.Error())
 		}
 	}
-	if errMessage != "" {
-		return errors.New(errMessage)
+	if failed == 0 {
+		return nil
 	}
-	return nil
+	if failed < len(subChannels) {
+		return &PartialSendError{
+			Failed: failed,
+			Total:  len(subChannels),
+			Err:    errors.New(errMessage),
+		}
+	}
+	return errors.New(errMessage)
+}
+
+// groupPreviewItem is the preview of a sub channel of the group.
+type groupPreviewItem struct {
+	Channel string   `json:"channel"`
+	Type    string   `json:"type"`
+	Payload *Payload `json:"payload,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// buildGroupPayload returns the previews of the sub channels, failed ones don't fail the whole preview.
+func buildGroupPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
+	subChannels := strings.Split(channel_.AppId, "|")
+	var subTargets []string
+	if message.To != "" {
+		subTargets = strings.Split(message.To, "|")
+	} else {
+		subTargets = strings.Split(channel_.AccountId, "|")
+	}
+	if len(subChannels) != len(subTargets) {
+		return nil, errors.New("无效的群组消息配置，子通道数量与子目标数量不一致")
+	}
+	originalTo, originalChannel := message.To, message.Channel
+	defer func() {
+		message.To, message.Channel = originalTo, originalChannel
+	}()
+	items := make([]groupPreviewItem, 0, len(subChannels))
+	for i := 0; i < len(subChannels); i++ {
+		message.To = subTargets[i]
+		message.Channel = subChannels[i]
+		item := groupPreviewItem{Channel: subChannels[i]}
+		subChannel, err := model.GetChannelByName(subChannels[i], user.Id)
+		if err != nil {
+			return nil, errors.New("获取群组消息子通道失败：" + err.Error())
+		}
+		item.Type = subChannel.Type
+		if subChannel.Type == model.TypeGroup {
+			return nil, errors.New("群组消息子通道不能是群组消息")
+		}
+		item.Payload, err = PreviewMessage(message, user, subChannel)
+		if err != nil {
+			item.Error = err.Error()
+		}
+		items = append(items, item)
+	}
+	return &Payload{Method: "GROUP", Body: items}, nil
+}
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeGroup,
+		schema: []ConfigField{
+			{Column: ColumnAppId, Type: FieldTypeString, Label: "渠道列表", Required: true},
+			{Column: ColumnAccountId, Type: FieldTypeString, Label: "默认推送目标", Required: false},
+		},
+		send:     SendGroupMessage,
+		validate: validateGroupChannel,
+		preview:  buildGroupPayload,
+	})
 }
@@ -34,10 +34,7 @@ func (i *LarkAppTokenStoreItem) Key() string {
 }
 
 func (i *LarkAppTokenStoreItem) IsShared() bool {
-	var count int64 = 0
-	model.DB.Model(&model.Channel{}).Where("secret = ? and app_id = ? and type = ?",
-		i.AppSecret, i.AppID, model.TypeLarkApp).Count(&count)
-	return count > 1
+	return model.CountChannelsBySecret(model.TypeLarkApp, i.AppID, i.AppSecret) > 1
 }
 
 func (i *LarkAppTokenStoreItem) IsFilled() bool {
@@ -55,7 +52,7 @@ func (i *LarkAppTokenStoreItem) Refresh() {
 		AppSecret: i.AppSecret,
 	}
 	tokenRequestData, err := json.Marshal(tokenRequest)
-	responseData, err := http.Post("https://open.feishu.cn/open-apis/auth/v3/tenant_access_token/internal",
+	responseData, err := getHTTPClient(nil).Post("https://open.feishu.cn/open-apis/auth/v3/tenant_access_token/internal",
 		"application/json; charset=utf-8", bytes.NewBuffer(tokenRequestData))
 	if err != nil {
 		common.SysError("failed to refresh access token: " + err.Error())
@@ -85,6 +82,9 @@ type larkAppMessageRequest struct {
 type larkAppMessageResponse struct {
 	Code int    `json:"code"`
 	Msg  string `json:"msg"`
+	Data struct {
+		MessageId string `json:"message_id"`
+	} `json:"data"`
 }
 
 func parseLarkAppTarget(target string) (string, string, error) {
@@ -95,7 +95,15 @@ func parseLarkAppTarget(target string) (string, string, error) {
 	return parts[0], parts[1], nil
 }
 
-func SendLarkAppMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+func validateLarkAppChannel(channel_ *model.Channel) error {
+	if channel_.AccountId == "" {
+		return nil
+	}
+	_, _, err := parseLarkAppTarget(channel_.AccountId)
+	return err
+}
+
+func buildLarkAppPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
 	// https://open.feishu.cn/document/uAjLw4CM/ukTMukTMukTM/reference/im-v1/message/create
 	rawTarget := message.To
 	if rawTarget == "" {
@@ -103,7 +111,7 @@ func SendLarkAppMessage(message *model.Message, user *model.User, channel_ *mode
 	}
 	targetType, target, err := parseLarkAppTarget(rawTarget)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	request := larkAppMessageRequest{
 		ReceiveId: target,
@@ -114,7 +122,7 @@ func SendLarkAppMessage(message *model.Message, user *model.User, channel_ *mode
 		content := larkTextContent{Text: atPrefix + message.Description}
 		contentData, err := json.Marshal(content)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		request.Content = string(contentData)
 	} else {
@@ -131,21 +139,34 @@ func SendLarkAppMessage(message *model.Message, user *model.User, channel_ *mode
 		})
 		contentData, err := json.Marshal(content)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		request.Content = string(contentData)
 	}
-	requestData, err := json.Marshal(request)
+	url := fmt.Sprintf("https://open.feishu.cn/open-apis/im/v1/messages?receive_id_type=%s", targetType)
+	return &Payload{Method: http.MethodPost, URL: url, Body: request}, nil
+}
+
+func SendLarkAppMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildLarkAppPayload(message, user, channel_)
+	if err != nil {
+		return err
+	}
+	requestData, err := payload.bodyBytes()
 	if err != nil {
 		return err
 	}
 	key := fmt.Sprintf("%s%s", channel_.AppId, channel_.Secret)
 	accessToken := TokenStoreGetToken(key)
-	url := fmt.Sprintf("https://open.feishu.cn/open-apis/im/v1/messages?receive_id_type=%s", targetType)
-	req, _ := http.NewRequest("POST", url, bytes.NewReader(requestData))
+	req, _ := http.NewRequest(payload.Method, payload.URL, bytes.NewReader(requestData))
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 	req.Header.Set("Content-Type", "application/json; charset=utf-8")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := getHTTPClient(channel_).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = checkResponseStatus(resp)
 	if err != nil {
 		return err
 	}
@@ -157,5 +178,20 @@ func SendLarkAppMessage(message *model.Message, user *model.User, channel_ *mode
 	if res.Code != 0 {
 		return errors.New(res.Msg)
 	}
+	message.RemoteId = res.Data.MessageId
 	return nil
 }
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeLarkApp,
+		schema: []ConfigField{
+			{Column: ColumnAppId, Type: FieldTypeString, Label: "App ID", Required: true},
+			{Column: ColumnSecret, Type: FieldTypeSecret, Label: "App Secret", Required: true},
+			{Column: ColumnAccountId, Type: FieldTypeString, Label: "默认推送目标", Required: false},
+		},
+		send:     SendLarkAppMessage,
+		validate: validateLarkAppChannel,
+		preview:  buildLarkAppPayload,
+	})
+}
@@ -65,7 +65,7 @@ func getLarkAtPrefix(message *model.Message) string {
 	return atPrefix
 }
 
-func SendLarkMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+func buildLarkPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
 	// https://open.feishu.cn/document/ukTMukTMukTM/ucTM5YjL3ETO24yNxkjN#e1cdee9f
 	messageRequest := larkMessageRequest{
 		MessageType: "text",
@@ -91,19 +91,32 @@ func SendLarkMessage(message *model.Message, user *model.User, channel_ *model.C
 	timestamp := now.Unix()
 	sign, err := larkSign(channel_.Secret, timestamp)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	messageRequest.Sign = sign
 	messageRequest.Timestamp = strconv.FormatInt(timestamp, 10)
-	jsonData, err := json.Marshal(messageRequest)
+	return &Payload{Method: http.MethodPost, URL: channel_.URL, Body: messageRequest}, nil
+}
+
+func SendLarkMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildLarkPayload(message, user, channel_)
 	if err != nil {
 		return err
 	}
-	resp, err := http.Post(channel_.URL, "application/json",
+	jsonData, err := payload.bodyBytes()
+	if err != nil {
+		return err
+	}
+	resp, err := getHTTPClient(channel_).Post(payload.URL, "application/json",
 		bytes.NewBuffer(jsonData))
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	err = checkResponseStatus(resp)
+	if err != nil {
+		return err
+	}
 	var res larkMessageResponse
 	err = json.NewDecoder(resp.Body).Decode(&res)
 	if err != nil {
@@ -128,3 +141,15 @@ func larkSign(secret string, timestamp int64) (string, error) {
 	signature := base64.StdEncoding.EncodeToString(h.Sum(nil))
 	return signature, nil
 }
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeLark,
+		schema: []ConfigField{
+			{Column: ColumnURL, Type: FieldTypeURL, Label: "Webhook 地址", Required: true},
+			{Column: ColumnSecret, Type: FieldTypeSecret, Label: "签名校验密钥", Required: false},
+		},
+		send:    SendLarkMessage,
+		preview: buildLarkPayload,
+	})
+}
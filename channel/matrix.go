@@ -0,0 +1,116 @@
+package channel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"message-pusher/common"
+	"message-pusher/model"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type matrixMessageRequest struct {
+	MsgType       string `json:"msgtype"` // m.text
+	Body          string `json:"body"`
+	Format        string `json:"format,omitempty"` // org.matrix.custom.html
+	FormattedBody string `json:"formatted_body,omitempty"`
+}
+
+type matrixMessageResponse struct {
+	EventId string `json:"event_id"`
+	ErrCode string `json:"errcode"`
+	Error   string `json:"error"`
+}
+
+// getMatrixTxnId returns the transaction ID of the message, the homeserver won't send the event again
+// if a retry uses the same ID. message.Link isn't used since it's not unique if the message isn't saved.
+func getMatrixTxnId(message *model.Message) string {
+	if message.SendId == "" {
+		// sent without retries, e.g. testing the channel
+		return "mp-" + common.GetUUID()
+	}
+	return "mp-" + message.SendId
+}
+
+func buildMatrixPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
+	roomId := channel_.AccountId
+	if message.To != "" {
+		roomId = message.To
+	}
+	body := message.Content
+	if body == "" {
+		body = message.Description
+	}
+	if message.Title != "" {
+		body = fmt.Sprintf("# %s\n\n%s", message.Title, body)
+	}
+	req := matrixMessageRequest{
+		MsgType: "m.text",
+		Body:    strings.TrimSpace(body),
+	}
+	if message.RenderMode != "raw" {
+		formattedBody, err := common.Markdown2HTML(req.Body)
+		if err != nil {
+			common.SysLog(err.Error())
+		} else {
+			req.Format = "org.matrix.custom.html"
+			req.FormattedBody = formattedBody
+		}
+	}
+	// https://spec.matrix.org/latest/client-server-api/#put_matrixclientv3roomsroomidsendeventtypetxnid
+	url_ := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s", strings.TrimSuffix(channel_.URL, "/"),
+		url.PathEscape(roomId), url.PathEscape(getMatrixTxnId(message)))
+	return &Payload{Method: http.MethodPut, URL: url_, Body: req}, nil
+}
+
+func SendMatrixMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildMatrixPayload(message, user, channel_)
+	if err != nil {
+		return err
+	}
+	reqBody, err := payload.bodyBytes()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(payload.Method, payload.URL, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+channel_.Secret)
+	resp, err := getHTTPClient(channel_).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = checkResponseStatus(resp)
+	if err != nil {
+		return err
+	}
+	var res matrixMessageResponse
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return err
+	}
+	if res.ErrCode != "" {
+		return errors.New(res.ErrCode + ": " + res.Error)
+	}
+	message.RemoteId = res.EventId
+	return nil
+}
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeMatrix,
+		schema: []ConfigField{
+			{Column: ColumnURL, Type: FieldTypeURL, Label: "Homeserver 地址", Required: true},
+			{Column: ColumnSecret, Type: FieldTypeSecret, Label: "Access Token", Required: true},
+			{Column: ColumnAccountId, Type: FieldTypeString, Label: "默认房间 ID", Required: true},
+		},
+		send:    SendMatrixMessage,
+		preview: buildMatrixPayload,
+	})
+}
@@ -0,0 +1,102 @@
+package channel
+
+import (
+	"encoding/json"
+	"errors"
+	"message-pusher/common"
+	"message-pusher/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSendMatrixMessage(t *testing.T) {
+	type request struct {
+		method string
+		path   string
+		auth   string
+		body   matrixMessageRequest
+	}
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{method: r.Method, path: r.URL.Path, auth: r.Header.Get("Authorization")}
+		if err := json.NewDecoder(r.Body).Decode(&req.body); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		requests = append(requests, req)
+		if strings.Contains(r.URL.Path, "!forbidden:example.org") {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errcode":"M_FORBIDDEN","error":"not in the room"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"event_id":"$event"}`))
+	}))
+	defer server.Close()
+	channel_ := &model.Channel{
+		Type:      model.TypeMatrix,
+		URL:       server.URL + "/",
+		Secret:    "access-token",
+		AccountId: "!room:example.org",
+	}
+
+	// the stub homeserver is on loopback, which can't be reached unless it's allowlisted
+	allowlist := common.OutboundAllowlist
+	defer func() {
+		common.OutboundAllowlist = allowlist
+	}()
+	common.OutboundAllowlist = ""
+	err := SendMatrixMessage(&model.Message{SendId: "blocked", Content: "hi"}, nil, channel_)
+	if !errors.Is(err, errForbiddenAddress) {
+		t.Fatalf("loopback should be blocked, got %v", err)
+	}
+	common.OutboundAllowlist = "127.0.0.1"
+
+	message := &model.Message{SendId: "send-id", Title: "Deploy", Content: "**done**"}
+	err = SendMatrixMessage(message, nil, channel_)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.RemoteId != "$event" {
+		t.Errorf("RemoteId = %q, want the event ID", message.RemoteId)
+	}
+	// a retry of the message uses the same transaction ID
+	err = SendMatrixMessage(message, nil, channel_)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SendMatrixMessage(&model.Message{SendId: "raw", To: "!other:example.org", Content: "**raw**", RenderMode: "raw"}, nil, channel_)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SendMatrixMessage(&model.Message{SendId: "forbidden", To: "!forbidden:example.org", Content: "hi"}, nil, channel_)
+	if err == nil {
+		t.Error("the error response of the homeserver should fail the message")
+	}
+
+	if len(requests) != 4 {
+		t.Fatalf("the homeserver received %d requests, want 4", len(requests))
+	}
+	const sendPath = "/_matrix/client/v3/rooms/!room:example.org/send/m.room.message/mp-send-id"
+	for _, req := range requests[:2] {
+		if req.method != http.MethodPut || req.path != sendPath {
+			t.Errorf("request = %s %s, want PUT %s", req.method, req.path, sendPath)
+		}
+		if req.auth != "Bearer access-token" {
+			t.Errorf("Authorization = %q", req.auth)
+		}
+		if req.body.MsgType != "m.text" || req.body.Body != "# Deploy\n\n**done**" {
+			t.Errorf("body = %+v", req.body)
+		}
+		if req.body.Format != "org.matrix.custom.html" || !strings.Contains(req.body.FormattedBody, "<strong>done</strong>") {
+			t.Errorf("formatted body = %q %q", req.body.Format, req.body.FormattedBody)
+		}
+	}
+	req := requests[2]
+	if want := "/_matrix/client/v3/rooms/!other:example.org/send/m.room.message/mp-raw"; req.path != want {
+		t.Errorf("path = %s, want %s", req.path, want)
+	}
+	if req.body.Body != "**raw**" || req.body.Format != "" || req.body.FormattedBody != "" {
+		t.Errorf("raw body = %+v", req.body)
+	}
+}
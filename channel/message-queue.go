@@ -1,30 +1,225 @@
 package channel
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
 	"message-pusher/common"
 	"message-pusher/model"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
-var AsyncMessageQueue chan int
 var AsyncMessageQueueSize = 128
 var AsyncMessageSenderNum = 2
 
-func init() {
-	AsyncMessageQueue = make(chan int, AsyncMessageQueueSize)
-	for i := 0; i < AsyncMessageSenderNum; i++ {
-		go asyncMessageSender()
+// AsyncMessageClaimIdle is how long a Redis stream entry can stay unacknowledged
+// before we consider its consumer dead and claim the entry.
+var AsyncMessageClaimIdle = 10 * time.Minute
+
+const (
+	asyncMessageStreamKey   = "message-pusher:async-messages"
+	asyncMessageStreamGroup = "message-pusher"
+)
+
+type asyncMessageQueue interface {
+	push(id int) error
+	start(senderNum int)
+}
+
+var asyncQueue asyncMessageQueue
+
+// asyncMessageQueueMaxWaiting limits the messages waiting for room when the in-memory queue is full.
+var asyncMessageQueueMaxWaiting int32 = 1024
+
+// memoryMessageQueue is the fallback when Redis is not enabled, it only works for single instance deployments.
+type memoryMessageQueue struct {
+	queue   chan int
+	waiting int32
+}
+
+func (q *memoryMessageQueue) push(id int) error {
+	select {
+	case q.queue <- id:
+	default:
+		// The queue is full, don't block the caller.
+		if atomic.AddInt32(&q.waiting, 1) > asyncMessageQueueMaxWaiting {
+			atomic.AddInt32(&q.waiting, -1)
+			return errors.New("async message queue is full")
+		}
+		go func() {
+			q.queue <- id
+			atomic.AddInt32(&q.waiting, -1)
+		}()
+	}
+	return nil
+}
+
+func (q *memoryMessageQueue) start(senderNum int) {
+	for i := 0; i < senderNum; i++ {
+		go func() {
+			for id := range q.queue {
+				processAsyncMessage(id, false)
+			}
+		}()
+	}
+}
+
+// redisMessageQueue is backed by a Redis stream consumed by a consumer group (Redis 6.2+),
+// so replicas share the work and entries of a dead worker are claimed by the others.
+type redisMessageQueue struct {
+	consumerPrefix string
+}
+
+func newRedisMessageQueue() *redisMessageQueue {
+	hostname, _ := os.Hostname()
+	return &redisMessageQueue{
+		consumerPrefix: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+	}
+}
+
+func (q *redisMessageQueue) push(id int) error {
+	return common.RDB.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: asyncMessageStreamKey,
+		Values: map[string]interface{}{"id": id},
+	}).Err()
+}
+
+func (q *redisMessageQueue) start(senderNum int) {
+	err := common.RDB.XGroupCreateMkStream(context.Background(), asyncMessageStreamKey, asyncMessageStreamGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		common.FatalLog("failed to create async message consumer group: " + err.Error())
+	}
+	for i := 0; i < senderNum; i++ {
+		go q.consume(fmt.Sprintf("%s-%d", q.consumerPrefix, i))
+	}
+	go q.claimStaleEntries(q.consumerPrefix + "-claimer")
+}
+
+func (q *redisMessageQueue) consume(consumer string) {
+	ctx := context.Background()
+	for {
+		streams, err := common.RDB.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    asyncMessageStreamGroup,
+			Consumer: consumer,
+			Streams:  []string{asyncMessageStreamKey, ">"},
+			Count:    1,
+			Block:    5 * time.Second,
+		}).Result()
+		if err != nil {
+			if err != redis.Nil {
+				common.SysError("failed to read async message queue: " + err.Error())
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		for _, stream := range streams {
+			for _, entry := range stream.Messages {
+				q.handle(entry, false)
+			}
+		}
+	}
+}
+
+func (q *redisMessageQueue) claimStaleEntries(consumer string) {
+	ctx := context.Background()
+	for {
+		time.Sleep(time.Minute)
+		start := "0-0"
+		for {
+			entries, next, err := common.RDB.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+				Stream:   asyncMessageStreamKey,
+				Group:    asyncMessageStreamGroup,
+				MinIdle:  AsyncMessageClaimIdle,
+				Start:    start,
+				Count:    10,
+				Consumer: consumer,
+			}).Result()
+			if err != nil {
+				common.SysError("failed to claim stale async messages: " + err.Error())
+				break
+			}
+			for _, entry := range entries {
+				q.handle(entry, true)
+			}
+			if next == "0-0" || len(entries) == 0 {
+				break
+			}
+			start = next
+		}
+	}
+}
+
+func (q *redisMessageQueue) handle(entry redis.XMessage, reclaim bool) {
+	id, err := strconv.Atoi(fmt.Sprint(entry.Values["id"]))
+	if err == nil {
+		processAsyncMessage(id, reclaim)
+	} else {
+		common.SysError("invalid async message queue entry: " + entry.ID)
+	}
+	// The result has been saved to the database, the entry is no longer needed.
+	ctx := context.Background()
+	err = common.RDB.XAck(ctx, asyncMessageStreamKey, asyncMessageStreamGroup, entry.ID).Err()
+	if err != nil {
+		common.SysError("failed to ack async message: " + err.Error())
+		return
+	}
+	common.RDB.XDel(ctx, asyncMessageStreamKey, entry.ID)
+}
+
+// InitAsyncMessageQueue This function is called after the database and Redis are initialized.
+func InitAsyncMessageQueue() {
+	if os.Getenv("ASYNC_MESSAGE_SENDER_NUM") != "" {
+		num, err := strconv.Atoi(os.Getenv("ASYNC_MESSAGE_SENDER_NUM"))
+		if err != nil || num <= 0 {
+			common.FatalLog("invalid ASYNC_MESSAGE_SENDER_NUM: " + os.Getenv("ASYNC_MESSAGE_SENDER_NUM"))
+		}
+		AsyncMessageSenderNum = num
 	}
+	if common.RedisEnabled {
+		asyncQueue = newRedisMessageQueue()
+		common.SysLog("Redis is enabled, using Redis stream as async message queue")
+	} else {
+		asyncQueue = &memoryMessageQueue{
+			queue: make(chan int, AsyncMessageQueueSize),
+		}
+	}
+	startTime := common.GetTimestamp()
+	asyncQueue.start(AsyncMessageSenderNum)
+	go func() {
+		if !common.RedisEnabled {
+			// Nobody else could have claimed them, the Redis queue reclaims them from the stream instead.
+			count, err := model.ResetStaleAsyncMessages(startTime)
+			if err != nil {
+				common.SysError("failed to reset stale async messages: " + err.Error())
+			} else if count > 0 {
+				common.SysLog(fmt.Sprintf("%d async messages left unfinished by the last run will be sent again", count))
+			}
+		}
+		LoadAsyncMessages()
+	}()
+}
+
+func EnqueueAsyncMessage(id int) error {
+	return asyncQueue.push(id)
 }
 
 // LoadAsyncMessages loads async pending messages from database.
-// We have to wait the database connection is ready.
+// Messages enqueued twice (e.g. by several instances) are only sent once, see processAsyncMessage.
 func LoadAsyncMessages() {
 	ids, err := model.GetAsyncPendingMessageIds()
 	if err != nil {
 		common.FatalLog("failed to load async pending messages: " + err.Error())
 	}
 	for _, id := range ids {
-		AsyncMessageQueue <- id
+		err = asyncQueue.push(id)
+		if err != nil {
+			common.SysError("failed to enqueue async message: " + err.Error())
+		}
 	}
 }
 
@@ -37,27 +232,41 @@ func asyncMessageSenderHelper(message *model.Message) error {
 	if err != nil {
 		return err
 	}
-	return SendMessage(message, user, channel_)
+	return SendMessageWithRetry(message, user, channel_)
 }
 
-func asyncMessageSender() {
-	for {
-		id := <-AsyncMessageQueue
-		message, err := model.GetMessageById(id)
-		if err != nil {
-			common.SysError("async message sender error: " + err.Error())
-			continue
-		}
-		err = asyncMessageSenderHelper(message)
-		status := common.MessageSendStatusFailed
-		if err != nil {
-			common.SysError("async message sender error: " + err.Error())
-		} else {
-			status = common.MessageSendStatusSent
-		}
-		err = message.UpdateStatus(status)
-		if err != nil {
-			common.SysError("async message sender error: " + err.Error())
+func processAsyncMessage(id int, reclaim bool) {
+	claimed, err := model.ClaimAsyncMessage(id, reclaim)
+	if err != nil {
+		common.SysError("async message sender error: " + err.Error())
+		return
+	}
+	if !claimed {
+		// already sent, or being sent by another worker
+		return
+	}
+	message, err := model.GetMessageById(id)
+	if err != nil {
+		common.SysError("async message sender error: " + err.Error())
+		return
+	}
+	err = asyncMessageSenderHelper(message)
+	status := common.MessageSendStatusFailed
+	if err != nil {
+		common.SysError("async message sender error: " + err.Error())
+		if IsPartialSendError(err) {
+			status = common.MessageSendStatusPartiallySent
 		}
+	} else {
+		status = common.MessageSendStatusSent
+	}
+	err = message.UpdateStatus(status)
+	if err != nil {
+		common.SysError("async message sender error: " + err.Error())
+	}
+	// The notification of an alert is counted as sent only after it's delivered.
+	err = model.CompleteAlertSendByLink(message.UserId, message.Link, status != common.MessageSendStatusFailed, common.GetTimestamp())
+	if err != nil {
+		common.SysError("async message sender error: " + err.Error())
 	}
 }
@@ -0,0 +1,124 @@
+package channel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"message-pusher/model"
+	"net/http"
+	"strings"
+)
+
+type ntfyAction struct {
+	Action string `json:"action"` // view
+	Label  string `json:"label"`
+	URL    string `json:"url"`
+}
+
+type ntfyMessageRequest struct {
+	Topic    string       `json:"topic"`
+	Title    string       `json:"title,omitempty"`
+	Message  string       `json:"message"`
+	Markdown bool         `json:"markdown,omitempty"`
+	Priority int          `json:"priority,omitempty"` // 1 (min) to 5 (max), same as model.Message
+	Tags     []string     `json:"tags,omitempty"`
+	Click    string       `json:"click,omitempty"`
+	Actions  []ntfyAction `json:"actions,omitempty"`
+}
+
+type ntfyMessageResponse struct {
+	Id    string `json:"id"`
+	Code  int    `json:"code"`
+	Error string `json:"error"`
+}
+
+// getNtfyTags parses the comma separated tags of the channel, tags matching an emoji short code are shown as emojis.
+func getNtfyTags(tags string) []string {
+	var result []string
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+func buildNtfyPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
+	// https://docs.ntfy.sh/publish/#publish-as-json
+	req := ntfyMessageRequest{
+		Topic:    channel_.AccountId,
+		Title:    message.Title,
+		Message:  message.Content,
+		Markdown: message.RenderMode != "raw",
+		Priority: message.Priority,
+		Tags:     getNtfyTags(channel_.Other),
+		Click:    message.URL,
+	}
+	if message.To != "" {
+		req.Topic = message.To
+	}
+	if req.Message == "" {
+		req.Message = message.Description
+	}
+	if message.URL != "" && message.Btntxt != "" {
+		req.Actions = append(req.Actions, ntfyAction{
+			Action: "view",
+			Label:  message.Btntxt,
+			URL:    message.URL,
+		})
+	}
+	return &Payload{Method: http.MethodPost, URL: strings.TrimSuffix(channel_.URL, "/"), Body: req}, nil
+}
+
+func SendNtfyMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildNtfyPayload(message, user, channel_)
+	if err != nil {
+		return err
+	}
+	reqBody, err := payload.bodyBytes()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(payload.Method, payload.URL, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if channel_.Secret != "" {
+		req.Header.Set("Authorization", "Bearer "+channel_.Secret)
+	}
+	resp, err := getHTTPClient(channel_).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = checkResponseStatus(resp)
+	if err != nil {
+		return err
+	}
+	var res ntfyMessageResponse
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return err
+	}
+	if res.Error != "" {
+		return errors.New(res.Error)
+	}
+	message.RemoteId = res.Id
+	return nil
+}
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeNtfy,
+		schema: []ConfigField{
+			{Column: ColumnURL, Type: FieldTypeURL, Label: "服务器地址", Required: true},
+			{Column: ColumnAccountId, Type: FieldTypeString, Label: "主题", Required: true},
+			{Column: ColumnSecret, Type: FieldTypeSecret, Label: "Access Token", Required: false},
+			{Column: ColumnOther, Type: FieldTypeString, Label: "标签（以英文逗号分隔）", Required: false},
+		},
+		send:    SendNtfyMessage,
+		preview: buildNtfyPayload,
+	})
+}
@@ -25,18 +25,7 @@ type oneBotMessageResponse struct {
 	RetCode int    `json:"retcode"`
 }
 
-func SendOneBotMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
-	url := fmt.Sprintf("%s/send_msg", channel_.URL)
-	req := oneBotMessageRequest{
-		Message: message.Content,
-	}
-	if message.Content == "" {
-		req.Message = message.Description
-	}
-	target := channel_.AccountId
-	if message.To != "" {
-		target = message.To
-	}
+func parseOneBotTarget(target string) (string, int64, error) {
 	parts := strings.Split(target, "_")
 	var idStr string
 	var type_ string
@@ -47,29 +36,66 @@ func SendOneBotMessage(message *model.Message, user *model.User, channel_ *model
 		type_ = parts[0]
 		idStr = parts[1]
 	} else {
-		return errors.New("无效的 OneBot 配置")
+		return "", 0, errors.New("无效的 OneBot 配置")
+	}
+	if type_ != "user" && type_ != "group" {
+		return "", 0, errors.New("无效的 OneBot 配置")
 	}
 	id, _ := strconv.ParseInt(idStr, 10, 64)
+	return type_, id, nil
+}
+
+func validateOneBotChannel(channel_ *model.Channel) error {
+	if channel_.AccountId == "" {
+		return nil
+	}
+	_, _, err := parseOneBotTarget(channel_.AccountId)
+	return err
+}
+
+func buildOneBotPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
+	url := fmt.Sprintf("%s/send_msg", channel_.URL)
+	req := oneBotMessageRequest{
+		Message: message.Content,
+	}
+	if message.Content == "" {
+		req.Message = message.Description
+	}
+	target := channel_.AccountId
+	if message.To != "" {
+		target = message.To
+	}
+	type_, id, err := parseOneBotTarget(target)
+	if err != nil {
+		return nil, err
+	}
 	if type_ == "user" {
 		req.UserId = id
 		req.MessageType = "private"
-	} else if type_ == "group" {
+	} else {
 		req.GroupId = id
 		req.MessageType = "group"
-	} else {
-		return errors.New("无效的 OneBot 配置")
 	}
-	reqBody, err := json.Marshal(req)
+	return &Payload{Method: http.MethodPost, URL: url, Body: req}, nil
+}
+
+func SendOneBotMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildOneBotPayload(message, user, channel_)
+	if err != nil {
+		return err
+	}
+	reqBody, err := payload.bodyBytes()
 	if err != nil {
 		return err
 	}
-	request, _ := http.NewRequest("POST", url, bytes.NewReader(reqBody))
+	request, _ := http.NewRequest("POST", payload.URL, bytes.NewReader(reqBody))
 	request.Header.Set("Authorization", "Bearer "+channel_.Secret)
 	request.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(request)
+	resp, err := getHTTPClient(channel_).Do(request)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
 		return errors.New(resp.Status)
 	}
@@ -83,3 +109,17 @@ func SendOneBotMessage(message *model.Message, user *model.User, channel_ *model
 	}
 	return nil
 }
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeOneBot,
+		schema: []ConfigField{
+			{Column: ColumnURL, Type: FieldTypeURL, Label: "服务器地址", Required: true},
+			{Column: ColumnSecret, Type: FieldTypeSecret, Label: "推送 key", Required: false},
+			{Column: ColumnAccountId, Type: FieldTypeString, Label: "默认推送目标", Required: false},
+		},
+		send:     SendOneBotMessage,
+		validate: validateOneBotChannel,
+		preview:  buildOneBotPayload,
+	})
+}
@@ -0,0 +1,92 @@
+package channel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"message-pusher/model"
+	"net/http"
+	"strings"
+)
+
+const pushDeerDefaultServer = "https://api2.pushdeer.com"
+
+type pushDeerMessageRequest struct {
+	PushKey string `json:"pushkey"`
+	Text    string `json:"text"`
+	Desp    string `json:"desp,omitempty"`
+	Type    string `json:"type"` // text, markdown, image
+}
+
+type pushDeerMessageResponse struct {
+	Code  int    `json:"code"`
+	Error string `json:"error"`
+}
+
+func buildPushDeerPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
+	// https://www.pushdeer.com/dev.html
+	server := channel_.URL
+	if server == "" {
+		server = pushDeerDefaultServer
+	}
+	req := pushDeerMessageRequest{
+		PushKey: channel_.Secret,
+		Text:    message.Title,
+		Desp:    message.Content,
+		Type:    "markdown",
+	}
+	if req.Desp == "" {
+		req.Desp = message.Description
+	}
+	if message.RenderMode == "raw" {
+		req.Type = "text"
+		if req.Desp != "" {
+			req.Text = fmt.Sprintf("%s\n%s", req.Text, req.Desp)
+		}
+		req.Desp = ""
+	}
+	url := fmt.Sprintf("%s/message/push", strings.TrimSuffix(server, "/"))
+	return &Payload{Method: http.MethodPost, URL: url, Body: req}, nil
+}
+
+func SendPushDeerMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildPushDeerPayload(message, user, channel_)
+	if err != nil {
+		return err
+	}
+	reqBody, err := payload.bodyBytes()
+	if err != nil {
+		return err
+	}
+	resp, err := getHTTPClient(channel_).Post(payload.URL, "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = checkResponseStatus(resp)
+	if err != nil {
+		return err
+	}
+	var res pushDeerMessageResponse
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return err
+	}
+	if res.Code != 0 {
+		return errors.New(res.Error)
+	}
+	return nil
+}
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypePushDeer,
+		schema: []ConfigField{
+			{Column: ColumnURL, Type: FieldTypeURL, Label: "服务器地址（留空使用官方服务器）", Required: false},
+			{Column: ColumnSecret, Type: FieldTypeSecret, Label: "PushKey", Required: true},
+		},
+		send:    SendPushDeerMessage,
+		preview: buildPushDeerPayload,
+	})
+}
@@ -0,0 +1,186 @@
+package channel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"message-pusher/common"
+	"message-pusher/model"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const pushoverMessagesURL = "https://api.pushover.net/1/messages.json"
+
+// pushoverPriorities maps the message priorities to Pushover's -2 (lowest) to 2 (emergency).
+var pushoverPriorities = map[int]int{1: -2, 2: -1, 3: 0, 4: 1, 5: 2}
+
+const pushoverPriorityEmergency = 2
+
+// pushoverOptions is stored in the channel's Other column as JSON.
+type pushoverOptions struct {
+	Sound  string `json:"sound"`
+	Retry  int    `json:"retry"`  // seconds between retries of emergency messages, at least 30
+	Expire int    `json:"expire"` // seconds before emergency messages stop retrying, at most 10800
+}
+
+type pushoverMessageRequest struct {
+	Token    string `json:"token"`
+	User     string `json:"user"`
+	Device   string `json:"device,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Message  string `json:"message"`
+	HTML     int    `json:"html,omitempty"`
+	URL      string `json:"url,omitempty"`
+	URLTitle string `json:"url_title,omitempty"`
+	Priority int    `json:"priority,omitempty"`
+	Retry    int    `json:"retry,omitempty"`
+	Expire   int    `json:"expire,omitempty"`
+	Sound    string `json:"sound,omitempty"`
+}
+
+type pushoverMessageResponse struct {
+	Status  int      `json:"status"`
+	Request string   `json:"request"`
+	Receipt string   `json:"receipt"` // only for emergency messages
+	Errors  []string `json:"errors"`
+}
+
+var (
+	pushoverCommentRegex = regexp.MustCompile(`<!--.*?-->`)
+	pushoverHeadingRegex = regexp.MustCompile(`<(/?)h[1-6][^>]*>`)
+	// Pushover only supports these tags, see https://pushover.net/api#html
+	pushoverTagRegex = regexp.MustCompile(`</?([a-zA-Z0-9]+)[^>]*>`)
+)
+
+// markdownToPushoverHTML renders markdown to HTML with the tags Pushover supports only.
+func markdownToPushoverHTML(markdown string) (string, error) {
+	html, err := common.Markdown2HTML(markdown)
+	if err != nil {
+		return "", err
+	}
+	html = pushoverCommentRegex.ReplaceAllString(html, "")
+	html = strings.NewReplacer("<strong>", "<b>", "</strong>", "</b>", "<em>", "<i>", "</em>", "</i>", "<li>", "• ").Replace(html)
+	html = pushoverHeadingRegex.ReplaceAllString(html, "<${1}b>")
+	html = pushoverTagRegex.ReplaceAllStringFunc(html, func(tag string) string {
+		switch pushoverTagRegex.FindStringSubmatch(tag)[1] {
+		case "b", "i", "u", "a", "font":
+			return tag
+		}
+		return ""
+	})
+	return strings.TrimSpace(html), nil
+}
+
+func getPushoverOptions(channel_ *model.Channel) (*pushoverOptions, error) {
+	options := pushoverOptions{Retry: 60, Expire: 3600}
+	if channel_.Other != "" {
+		err := json.Unmarshal([]byte(channel_.Other), &options)
+		if err != nil {
+			return nil, errors.New("无效的 Pushover 选项：" + err.Error())
+		}
+	}
+	return &options, nil
+}
+
+func validatePushoverChannel(channel_ *model.Channel) error {
+	options, err := getPushoverOptions(channel_)
+	if err != nil {
+		return err
+	}
+	if options.Retry < 30 {
+		return errors.New("紧急消息的重试间隔不能小于 30 秒")
+	}
+	if options.Expire <= 0 || options.Expire > 10800 {
+		return errors.New("紧急消息的重试时长需要在 1-10800 秒之间")
+	}
+	return nil
+}
+
+func buildPushoverPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
+	options, err := getPushoverOptions(channel_)
+	if err != nil {
+		return nil, err
+	}
+	req := pushoverMessageRequest{
+		Token:    channel_.Secret,
+		User:     channel_.AccountId,
+		Device:   strings.ReplaceAll(message.To, "|", ","),
+		Title:    message.Title,
+		Message:  message.Content,
+		URL:      message.URL,
+		URLTitle: message.Btntxt,
+		Priority: pushoverPriorities[message.Priority],
+		Sound:    options.Sound,
+	}
+	if req.Message == "" {
+		req.Message = message.Description
+	}
+	if req.Message == "" {
+		// the message is required by Pushover
+		req.Message = message.Title
+	}
+	if message.RenderMode != "raw" {
+		html, err := markdownToPushoverHTML(req.Message)
+		if err != nil {
+			common.SysLog(err.Error())
+		} else {
+			req.Message = html
+			req.HTML = 1
+		}
+	}
+	if req.Priority == pushoverPriorityEmergency {
+		req.Retry = options.Retry
+		req.Expire = options.Expire
+	}
+	return &Payload{Method: http.MethodPost, URL: pushoverMessagesURL, Body: req}, nil
+}
+
+func SendPushoverMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildPushoverPayload(message, user, channel_)
+	if err != nil {
+		return err
+	}
+	reqBody, err := payload.bodyBytes()
+	if err != nil {
+		return err
+	}
+	resp, err := getHTTPClient(channel_).Post(payload.URL, "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = checkResponseStatus(resp)
+	if err != nil {
+		return err
+	}
+	var res pushoverMessageResponse
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return err
+	}
+	if res.Status != 1 {
+		return errors.New(strings.Join(res.Errors, "; "))
+	}
+	// the receipt can be used to check whether an emergency message is acknowledged
+	message.RemoteId = res.Request
+	if res.Receipt != "" {
+		message.RemoteId = res.Receipt
+	}
+	return nil
+}
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypePushover,
+		schema: []ConfigField{
+			{Column: ColumnSecret, Type: FieldTypeSecret, Label: "应用 Token", Required: true},
+			{Column: ColumnAccountId, Type: FieldTypeString, Label: "用户 Key", Required: true},
+			{Column: ColumnOther, Type: FieldTypeJSON, Label: "选项", Required: false},
+		},
+		send:     SendPushoverMessage,
+		validate: validatePushoverChannel,
+		preview:  buildPushoverPayload,
+	})
+}
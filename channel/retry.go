@@ -0,0 +1,221 @@
+package channel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"message-pusher/common"
+	"message-pusher/model"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+var DefaultRetryPolicy = model.RetryPolicy{
+	MaxAttempts:  3,
+	InitialDelay: 1000,
+	MaxDelay:     30 * 1000,
+	Multiplier:   2,
+	Jitter:       0.2,
+}
+
+var RetryMaxAttemptsLimit = 10
+
+// RetryMaxDelayLimit caps the delays of retry policies, unit: millisecond.
+var RetryMaxDelayLimit = 60 * 1000
+
+// RetryMaxDuration bounds the time spent on retrying a message, including all sub channels of a group.
+// The push request waits for it, and async messages must finish long before AsyncMessageClaimIdle,
+// otherwise they are taken as abandoned and sent again.
+var RetryMaxDuration = 2 * time.Minute
+
+// SendError is returned by senders which know whether the failure is worth retrying,
+// e.g. a 429 or 5xx response from the upstream API.
+type SendError struct {
+	StatusCode int
+	Retryable  bool
+	Err        error
+}
+
+func (e *SendError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// checkResponseStatus turns rate limiting and server errors into retryable errors.
+func checkResponseStatus(resp *http.Response) error {
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return &SendError{
+			StatusCode: resp.StatusCode,
+			Retryable:  true,
+			Err:        errors.New(resp.Status),
+		}
+	}
+	return nil
+}
+
+// IsRetryableError reports whether err is a transient failure.
+// Auth and config errors returned by the upstream API are not, retrying them won't help.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var sendErr *SendError
+	if errors.As(err, &sendErr) {
+		return sendErr.Retryable
+	}
+	if errors.Is(err, errForbiddenAddress) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+func getRetryPolicy(channel_ *model.Channel) model.RetryPolicy {
+	policy := channel_.RetryPolicy
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if policy.InitialDelay <= 0 {
+		policy.InitialDelay = DefaultRetryPolicy.InitialDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = DefaultRetryPolicy.Multiplier
+	}
+	if policy.Jitter <= 0 {
+		policy.Jitter = DefaultRetryPolicy.Jitter
+	}
+	// policies saved before the limit was added
+	if policy.InitialDelay > RetryMaxDelayLimit {
+		policy.InitialDelay = RetryMaxDelayLimit
+	}
+	if policy.MaxDelay > RetryMaxDelayLimit {
+		policy.MaxDelay = RetryMaxDelayLimit
+	}
+	return policy
+}
+
+func validateRetryPolicy(policy model.RetryPolicy) error {
+	if policy.MaxAttempts < 0 || policy.MaxAttempts > RetryMaxAttemptsLimit {
+		return fmt.Errorf("最大尝试次数必须在 0-%d 之间", RetryMaxAttemptsLimit)
+	}
+	if policy.InitialDelay < 0 || policy.MaxDelay < 0 {
+		return errors.New("重试间隔不能为负数")
+	}
+	if policy.InitialDelay > RetryMaxDelayLimit || policy.MaxDelay > RetryMaxDelayLimit {
+		return fmt.Errorf("重试间隔不能超过 %d 毫秒", RetryMaxDelayLimit)
+	}
+	if policy.Multiplier < 0 {
+		return errors.New("退避倍数不能为负数")
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		return errors.New("随机抖动比例必须在 0-1 之间")
+	}
+	return nil
+}
+
+// getRetryDelay returns the delay before the next attempt, attempt starts from 1.
+func getRetryDelay(policy model.RetryPolicy, attempt int) time.Duration {
+	delay := float64(policy.InitialDelay) * math.Pow(policy.Multiplier, float64(attempt-1))
+	if delay > float64(policy.MaxDelay) {
+		delay = float64(policy.MaxDelay)
+	}
+	delay += delay * policy.Jitter * (rand.Float64()*2 - 1)
+	return time.Duration(delay) * time.Millisecond
+}
+
+func recordAttempt(message *model.Message, channel_ *model.Channel, attempt int, sendErr error) {
+	if message.Id == 0 {
+		// unsaved message, nowhere to attach the record
+		return
+	}
+	record := model.MessageAttempt{
+		MessageId: message.Id,
+		Channel:   channel_.Name,
+		Target:    message.To,
+		Attempt:   attempt,
+		Success:   sendErr == nil,
+		Timestamp: common.GetTimestamp(),
+	}
+	if sendErr != nil {
+		record.Error = sendErr.Error()
+	}
+	err := record.Insert()
+	if err != nil {
+		common.SysError("failed to record message attempt: " + err.Error())
+	}
+}
+
+func recordDelivery(message *model.Message, channel_ *model.Channel, attempts int, sendErr error) {
+	if message.Id == 0 {
+		return
+	}
+	delivery := model.MessageDelivery{
+		MessageId:   message.Id,
+		Channel:     channel_.Name,
+		Target:      message.To,
+		Status:      common.MessageSendStatusSent,
+		Attempts:    attempts,
+		RemoteId:    message.RemoteId,
+		UpdatedTime: common.GetTimestamp(),
+	}
+	if sendErr != nil {
+		delivery.Status = common.MessageSendStatusFailed
+		delivery.LastError = sendErr.Error()
+	}
+	err := delivery.Save()
+	if err != nil {
+		common.SysError("failed to record message delivery: " + err.Error())
+	}
+}
+
+// SendMessageWithRetry sends the message and retries transient failures
+// according to the channel's retry policy, every attempt and the final delivery are recorded.
+func SendMessageWithRetry(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	if message.RetryDeadline.IsZero() {
+		message.RetryDeadline = time.Now().Add(RetryMaxDuration)
+		defer func() {
+			message.RetryDeadline = time.Time{}
+		}()
+	}
+	if channel_.Type == model.TypeGroup {
+		// SendGroupMessage retries each sub channel on its own,
+		// so a failed sub channel won't resend the message to the succeeded ones.
+		return SendMessage(message, user, channel_)
+	}
+	policy := getRetryPolicy(channel_)
+	message.SendId = common.GetUUID()
+	for attempt := 1; ; attempt++ {
+		message.RemoteId = ""
+		err := SendMessage(message, user, channel_)
+		recordAttempt(message, channel_, attempt, err)
+		delay := getRetryDelay(policy, attempt)
+		if err == nil || attempt >= policy.MaxAttempts || !IsRetryableError(err) || time.Now().Add(delay).After(message.RetryDeadline) {
+			recordDelivery(message, channel_, attempt, err)
+			return err
+		}
+		common.SysLog(fmt.Sprintf("failed to send message through channel %s, retry in %v: %s", channel_.Name, delay, err.Error()))
+		time.Sleep(delay)
+	}
+}
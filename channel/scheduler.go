@@ -0,0 +1,44 @@
+package channel
+
+import (
+	"message-pusher/common"
+	"message-pusher/model"
+	"time"
+)
+
+var MessageSchedulerInterval = 5 * time.Second
+
+// InitMessageScheduler starts polling the database for due scheduled messages,
+// so scheduled messages survive restarts without being reloaded into memory.
+// This function is called after InitAsyncMessageQueue.
+func InitMessageScheduler() {
+	go func() {
+		for {
+			dispatchDueMessages()
+			time.Sleep(MessageSchedulerInterval)
+		}
+	}()
+}
+
+func dispatchDueMessages() {
+	ids, err := model.GetDueScheduledMessageIds(common.GetTimestamp())
+	if err != nil {
+		common.SysError("failed to load scheduled messages: " + err.Error())
+		return
+	}
+	for _, id := range ids {
+		dispatched, err := model.DispatchScheduledMessage(id)
+		if err != nil {
+			common.SysError("failed to dispatch scheduled message: " + err.Error())
+			continue
+		}
+		if !dispatched {
+			continue
+		}
+		err = EnqueueAsyncMessage(id)
+		if err != nil {
+			// it's async pending now, LoadAsyncMessages will pick it up after restarting
+			common.SysError("failed to enqueue scheduled message: " + err.Error())
+		}
+	}
+}
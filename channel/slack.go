@@ -0,0 +1,266 @@
+package channel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"message-pusher/model"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+
+// Slack limits the text of a section block to 3000 characters and a header block to 150.
+const (
+	slackSectionTextLimit = 3000
+	slackHeaderTextLimit  = 150
+)
+
+type slackText struct {
+	Type string `json:"type"` // plain_text, mrkdwn
+	Text string `json:"text"`
+}
+
+type slackBlockElement struct {
+	Type string     `json:"type"`
+	Text *slackText `json:"text,omitempty"`
+	URL  string     `json:"url,omitempty"`
+}
+
+type slackBlock struct {
+	Type     string              `json:"type"` // header, section, actions
+	Text     *slackText          `json:"text,omitempty"`
+	Elements []slackBlockElement `json:"elements,omitempty"`
+}
+
+type slackMessageRequest struct {
+	Channel string       `json:"channel,omitempty"` // only for the bot API
+	Text    string       `json:"text"`              // fallback for notifications
+	Blocks  []slackBlock `json:"blocks"`
+}
+
+type slackMessageResponse struct {
+	Ok    bool   `json:"ok"`
+	Error string `json:"error"`
+	Ts    string `json:"ts"`
+}
+
+var (
+	slackLinkRegex    = regexp.MustCompile(`\[([^\]]+)\]\((\S+?)\)`)
+	slackBoldRegex    = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	slackItalicRegex  = regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*`)
+	slackStrikeRegex  = regexp.MustCompile(`~~(.+?)~~`)
+	slackHeadingRegex = regexp.MustCompile(`^#{1,6}\s+(.*)$`)
+	slackListRegex    = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+)
+
+func escapeSlackText(text string) string {
+	text = strings.ReplaceAll(text, "&", "&amp;")
+	text = strings.ReplaceAll(text, "<", "&lt;")
+	return strings.ReplaceAll(text, ">", "&gt;")
+}
+
+// convertSlackInline converts the inline markdown of a line, inline code is kept as is.
+func convertSlackInline(line string) string {
+	parts := strings.Split(line, "`")
+	for i := 0; i < len(parts); i += 2 {
+		part := slackLinkRegex.ReplaceAllString(parts[i], "<$2|$1>")
+		// bold is marked with \x00 first, so that it isn't taken as italic
+		part = slackBoldRegex.ReplaceAllString(part, "\x00$1$2\x00")
+		part = slackItalicRegex.ReplaceAllString(part, "_${1}_")
+		part = slackStrikeRegex.ReplaceAllString(part, "~$1~")
+		parts[i] = strings.ReplaceAll(part, "\x00", "*")
+	}
+	return strings.Join(parts, "`")
+}
+
+// markdownToSlackMrkdwn converts markdown to Slack's mrkdwn, which has no headings and uses single markers.
+// See: https://api.slack.com/reference/surfaces/formatting
+func markdownToSlackMrkdwn(markdown string) string {
+	lines := strings.Split(escapeSlackText(markdown), "\n")
+	inCodeBlock := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCodeBlock = !inCodeBlock
+			lines[i] = "```"
+			continue
+		}
+		if inCodeBlock {
+			continue
+		}
+		if matches := slackHeadingRegex.FindStringSubmatch(line); matches != nil {
+			// headings are rendered in bold, bold inside them would break it
+			lines[i] = "*" + convertSlackInline(slackBoldRegex.ReplaceAllString(matches[1], "$1$2")) + "*"
+			continue
+		}
+		line = slackListRegex.ReplaceAllString(line, "$1• ")
+		lines[i] = convertSlackInline(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// getSlackMentions supports user, channel and user group IDs, @all and @here.
+func getSlackMentions(to string) string {
+	if to == "" {
+		return ""
+	}
+	mentions := ""
+	for _, id := range strings.Split(to, "|") {
+		switch {
+		case id == "@all":
+			mentions += "<!channel> "
+		case id == "@here":
+			mentions += "<!here> "
+		case strings.HasPrefix(id, "C"):
+			mentions += "<#" + id + "> "
+		case strings.HasPrefix(id, "S"):
+			mentions += "<!subteam^" + id + "> "
+		default:
+			mentions += "<@" + id + "> "
+		}
+	}
+	return mentions
+}
+
+// splitSlackText splits text into chunks within limit, preferring line breaks.
+func splitSlackText(text string, limit int) []string {
+	var chunks []string
+	for len([]rune(text)) > limit {
+		runes := []rune(text)
+		idx := strings.LastIndex(string(runes[:limit]), "\n")
+		if idx <= 0 {
+			idx = len(string(runes[:limit]))
+		}
+		chunks = append(chunks, text[:idx])
+		text = strings.TrimPrefix(text[idx:], "\n")
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+func validateSlackChannel(channel_ *model.Channel) error {
+	if channel_.URL == "" && channel_.Secret == "" {
+		return errors.New("Incoming Webhook 地址与 Bot Token 至少需要填写一个")
+	}
+	if channel_.URL == "" && channel_.AccountId == "" {
+		return errors.New("使用 Bot Token 发送时需要填写默认频道 ID")
+	}
+	return nil
+}
+
+func buildSlackPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
+	content := message.Content
+	if content == "" {
+		content = message.Description
+	}
+	text := getSlackMentions(message.To) + markdownToSlackMrkdwn(content)
+	req := slackMessageRequest{
+		Text: message.Title,
+	}
+	if message.Title != "" {
+		header := []rune(message.Title)
+		if len(header) > slackHeaderTextLimit {
+			header = append(header[:slackHeaderTextLimit-1], '…')
+		}
+		req.Blocks = append(req.Blocks, slackBlock{
+			Type: "header",
+			Text: &slackText{Type: "plain_text", Text: string(header)},
+		})
+	}
+	for _, chunk := range splitSlackText(text, slackSectionTextLimit) {
+		req.Blocks = append(req.Blocks, slackBlock{
+			Type: "section",
+			Text: &slackText{Type: "mrkdwn", Text: chunk},
+		})
+	}
+	if req.Text == "" {
+		req.Text = text
+	} else if text != "" {
+		req.Text += "\n" + text
+	}
+	if message.URL != "" {
+		buttonText := message.Btntxt
+		if buttonText == "" {
+			buttonText = "查看详情"
+		}
+		req.Blocks = append(req.Blocks, slackBlock{
+			Type: "actions",
+			Elements: []slackBlockElement{{
+				Type: "button",
+				Text: &slackText{Type: "plain_text", Text: buttonText},
+				URL:  message.URL,
+			}},
+		})
+	}
+	// the incoming webhook is preferred, it posts to the channel it was created for
+	if channel_.URL != "" {
+		return &Payload{Method: http.MethodPost, URL: channel_.URL, Body: req}, nil
+	}
+	req.Channel = channel_.AccountId
+	return &Payload{Method: http.MethodPost, URL: slackPostMessageURL, Body: req}, nil
+}
+
+func SendSlackMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildSlackPayload(message, user, channel_)
+	if err != nil {
+		return err
+	}
+	reqBody, err := payload.bodyBytes()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(payload.Method, payload.URL, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if channel_.URL == "" {
+		req.Header.Set("Authorization", "Bearer "+channel_.Secret)
+	}
+	resp, err := getHTTPClient(channel_).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = checkResponseStatus(resp)
+	if err != nil {
+		return err
+	}
+	if channel_.URL != "" {
+		// incoming webhooks respond with plain text, e.g. ok, invalid_payload
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			return errors.New(resp.Status + " " + string(body))
+		}
+		return nil
+	}
+	var res slackMessageResponse
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return err
+	}
+	if !res.Ok {
+		return errors.New(res.Error)
+	}
+	message.RemoteId = res.Ts
+	return nil
+}
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeSlack,
+		schema: []ConfigField{
+			{Column: ColumnURL, Type: FieldTypeURL, Label: "Incoming Webhook 地址", Required: false},
+			{Column: ColumnSecret, Type: FieldTypeSecret, Label: "Bot Token", Required: false},
+			{Column: ColumnAccountId, Type: FieldTypeString, Label: "默认频道 ID", Required: false},
+		},
+		send:     SendSlackMessage,
+		validate: validateSlackChannel,
+		preview:  buildSlackPayload,
+	})
+}
@@ -0,0 +1,179 @@
+package channel
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"message-pusher/model"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+type teamsCardElement struct {
+	Type     string `json:"type"` // TextBlock
+	Text     string `json:"text"`
+	Weight   string `json:"weight,omitempty"`
+	Size     string `json:"size,omitempty"`
+	IsSubtle bool   `json:"isSubtle,omitempty"`
+	Wrap     bool   `json:"wrap"`
+}
+
+type teamsCardAction struct {
+	Type  string `json:"type"` // Action.OpenUrl
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+type teamsMentionEntity struct {
+	Type      string `json:"type"` // mention
+	Text      string `json:"text"`
+	Mentioned struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"mentioned"`
+}
+
+type teamsCardContent struct {
+	Schema  string             `json:"$schema"`
+	Type    string             `json:"type"` // AdaptiveCard
+	Version string             `json:"version"`
+	Body    []teamsCardElement `json:"body"`
+	Actions []teamsCardAction  `json:"actions,omitempty"`
+	MSTeams struct {
+		Width    string               `json:"width"`
+		Entities []teamsMentionEntity `json:"entities,omitempty"`
+	} `json:"msteams"`
+}
+
+type teamsCardAttachment struct {
+	ContentType string           `json:"contentType"`
+	Content     teamsCardContent `json:"content"`
+}
+
+type teamsMessageRequest struct {
+	Type        string                `json:"type"` // message
+	Attachments []teamsCardAttachment `json:"attachments"`
+}
+
+var teamsHeadingRegex = regexp.MustCompile(`(?m)^#{1,6}\s+(.*)$`)
+
+// getTeamsMentions parses message.To, each target is an Entra ID (AAD) object ID or a user principal name,
+// optionally prefixed with the display name, e.g. Alice:alice@example.com
+func getTeamsMentions(to string) (prefix string, entities []teamsMentionEntity) {
+	if to == "" {
+		return "", nil
+	}
+	for _, target := range strings.Split(to, "|") {
+		name, id := target, target
+		if idx := strings.Index(target, ":"); idx > 0 {
+			name, id = target[:idx], target[idx+1:]
+		}
+		entity := teamsMentionEntity{
+			Type: "mention",
+			Text: "<at>" + name + "</at>",
+		}
+		entity.Mentioned.Id = id
+		entity.Mentioned.Name = name
+		entities = append(entities, entity)
+		prefix += entity.Text + " "
+	}
+	return prefix, entities
+}
+
+func buildTeamsPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
+	// https://learn.microsoft.com/en-us/microsoftteams/platform/task-modules-and-cards/cards/cards-reference#adaptive-card
+	card := teamsCardContent{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.4",
+	}
+	card.MSTeams.Width = "Full"
+	atPrefix, entities := getTeamsMentions(message.To)
+	card.MSTeams.Entities = entities
+	if message.Title != "" {
+		card.Body = append(card.Body, teamsCardElement{
+			Type:   "TextBlock",
+			Text:   message.Title,
+			Weight: "Bolder",
+			Size:   "Medium",
+			Wrap:   true,
+		})
+	}
+	if message.Description != "" {
+		card.Body = append(card.Body, teamsCardElement{
+			Type:     "TextBlock",
+			Text:     message.Description,
+			IsSubtle: message.Content != "",
+			Wrap:     true,
+		})
+	}
+	if message.Content != "" {
+		// TextBlock supports a subset of markdown without headings
+		card.Body = append(card.Body, teamsCardElement{
+			Type: "TextBlock",
+			Text: teamsHeadingRegex.ReplaceAllString(message.Content, "**$1**"),
+			Wrap: true,
+		})
+	}
+	if atPrefix != "" {
+		// the mention entities only work if their text appears in the card
+		card.Body = append([]teamsCardElement{{Type: "TextBlock", Text: atPrefix, Wrap: true}}, card.Body...)
+	}
+	if message.URL != "" {
+		title := message.Btntxt
+		if title == "" {
+			title = "查看详情"
+		}
+		card.Actions = append(card.Actions, teamsCardAction{
+			Type:  "Action.OpenUrl",
+			Title: title,
+			URL:   message.URL,
+		})
+	}
+	req := teamsMessageRequest{
+		Type: "message",
+		Attachments: []teamsCardAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content:     card,
+		}},
+	}
+	return &Payload{Method: http.MethodPost, URL: channel_.URL, Body: req}, nil
+}
+
+func SendTeamsMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildTeamsPayload(message, user, channel_)
+	if err != nil {
+		return err
+	}
+	reqBody, err := payload.bodyBytes()
+	if err != nil {
+		return err
+	}
+	resp, err := getHTTPClient(channel_).Post(payload.URL, "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = checkResponseStatus(resp)
+	if err != nil {
+		return err
+	}
+	// incoming webhooks respond with 200 and Workflows with 202, errors are described in plain text
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.New(strings.TrimSpace(resp.Status + " " + string(body)))
+	}
+	return nil
+}
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeTeams,
+		schema: []ConfigField{
+			{Column: ColumnURL, Type: FieldTypeURL, Label: "Webhook 地址", Required: true},
+		},
+		send:    SendTeamsMessage,
+		preview: buildTeamsPayload,
+	})
+}
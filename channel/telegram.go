@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"message-pusher/model"
 	"net/http"
+	"strconv"
 	"unicode/utf8"
 )
 
@@ -21,9 +22,13 @@ type telegramMessageRequest struct {
 type telegramMessageResponse struct {
 	Ok          bool   `json:"ok"`
 	Description string `json:"description"`
+	Result      struct {
+		MessageId int64 `json:"message_id"`
+	} `json:"result"`
 }
 
-func SendTelegramMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+// buildTelegramRequests splits long messages into several requests
+func buildTelegramRequests(message *model.Message, channel_ *model.Channel) []telegramMessageRequest {
 	// https://core.telegram.org/bots/api#sendmessage
 	messageRequest := telegramMessageRequest{
 		ChatId: channel_.AccountId,
@@ -37,6 +42,7 @@ func SendTelegramMessage(message *model.Message, user *model.User, channel_ *mod
 		messageRequest.Text = message.Content
 		messageRequest.ParseMode = "markdown"
 	}
+	var requests []telegramMessageRequest
 	text := messageRequest.Text
 	idx := 0
 	for idx < len(text) {
@@ -49,23 +55,59 @@ func SendTelegramMessage(message *model.Message, user *model.User, channel_ *mod
 		}
 		messageRequest.Text = text[idx:nextIdx]
 		idx = nextIdx
-		jsonData, err := json.Marshal(messageRequest)
-		if err != nil {
-			return err
-		}
-		resp, err := http.Post(fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", channel_.Secret), "application/json",
-			bytes.NewBuffer(jsonData))
-		if err != nil {
-			return err
-		}
-		var res telegramMessageResponse
-		err = json.NewDecoder(resp.Body).Decode(&res)
+		requests = append(requests, messageRequest)
+	}
+	return requests
+}
+
+func getTelegramSendMessageURL(channel_ *model.Channel) string {
+	return fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", channel_.Secret)
+}
+
+func previewTelegramMessage(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
+	return &Payload{
+		Method: http.MethodPost,
+		URL:    getTelegramSendMessageURL(channel_),
+		Body:   buildTelegramRequests(message, channel_),
+	}, nil
+}
+
+func sendTelegramRequest(channel_ *model.Channel, messageRequest telegramMessageRequest) (*telegramMessageResponse, error) {
+	jsonData, err := json.Marshal(messageRequest)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := getHTTPClient(channel_).Post(getTelegramSendMessageURL(channel_), "application/json",
+		bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	err = checkResponseStatus(resp)
+	if err != nil {
+		return nil, err
+	}
+	var res telegramMessageResponse
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func SendTelegramMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	for _, messageRequest := range buildTelegramRequests(message, channel_) {
+		res, err := sendTelegramRequest(channel_, messageRequest)
 		if err != nil {
 			return err
 		}
 		if !res.Ok {
 			return errors.New(res.Description)
 		}
+		if message.RemoteId == "" {
+			// long message is split into several ones, the first one identifies them
+			message.RemoteId = strconv.FormatInt(res.Result.MessageId, 10)
+		}
 	}
 	return nil
 }
@@ -108,3 +150,15 @@ func getMarkdownNearestValidSplit(s string, idx int) int {
 	// unable to find a '\n'
 	return idx
 }
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeTelegram,
+		schema: []ConfigField{
+			{Column: ColumnSecret, Type: FieldTypeSecret, Label: "Telegram 机器人令牌", Required: true},
+			{Column: ColumnAccountId, Type: FieldTypeString, Label: "Telegram 会话 ID", Required: true},
+		},
+		send:    SendTelegramMessage,
+		preview: previewTelegramMessage,
+	})
+}
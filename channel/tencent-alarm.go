@@ -22,7 +22,7 @@ type TencentAlarmResponse struct {
 	CodeDesc string `json:"codeDesc"`
 }
 
-func SendTencentAlarmMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+func buildTencentAlarmPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
 	secretId := channel_.AppId
 	secretKey := channel_.Secret
 	policyId := channel_.AccountId
@@ -59,16 +59,23 @@ func SendTencentAlarmMessage(message *model.Message, user *model.User, channel_
 	params["Signature"] = signature
 
 	urlStr := "https://monitor.api.qcloud.com/v2/index.php?" + urlEncode(params)
+	return &Payload{Method: http.MethodGet, URL: urlStr}, nil
+}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", urlStr, nil)
+func SendTencentAlarmMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildTencentAlarmPayload(message, user, channel_)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(payload.Method, payload.URL, nil)
 	if err != nil {
 		return err
 	}
-	resp, err := client.Do(req)
+	resp, err := getHTTPClient(channel_).Do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	var response TencentAlarmResponse
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
@@ -87,3 +94,17 @@ func urlEncode(params map[string]string) string {
 	}
 	return strings.Join(encodedParams, "&")
 }
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeTencentAlarm,
+		schema: []ConfigField{
+			{Column: ColumnAppId, Type: FieldTypeString, Label: "SecretId", Required: true},
+			{Column: ColumnSecret, Type: FieldTypeSecret, Label: "SecretKey", Required: true},
+			{Column: ColumnAccountId, Type: FieldTypeString, Label: "消息策略 ID", Required: true},
+			{Column: ColumnOther, Type: FieldTypeString, Label: "区域", Required: true},
+		},
+		send:    SendTencentAlarmMessage,
+		preview: buildTencentAlarmPayload,
+	})
+}
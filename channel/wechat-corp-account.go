@@ -9,7 +9,6 @@ import (
 	"message-pusher/model"
 	"net/http"
 	"strings"
-	"time"
 )
 
 type wechatCorpAccountResponse struct {
@@ -32,10 +31,7 @@ func (i *WeChatCorpAccountTokenStoreItem) Key() string {
 
 func (i *WeChatCorpAccountTokenStoreItem) IsShared() bool {
 	appId := fmt.Sprintf("%s|%s", i.CorpId, i.AgentId)
-	var count int64 = 0
-	model.DB.Model(&model.Channel{}).Where("secret = ? and app_id = ? and type = ?",
-		i.AgentSecret, appId, model.TypeWeChatCorpAccount).Count(&count)
-	return count > 1
+	return model.CountChannelsBySecret(model.TypeWeChatCorpAccount, appId, i.AgentSecret) > 1
 }
 
 func (i *WeChatCorpAccountTokenStoreItem) IsFilled() bool {
@@ -48,16 +44,13 @@ func (i *WeChatCorpAccountTokenStoreItem) Token() string {
 
 func (i *WeChatCorpAccountTokenStoreItem) Refresh() {
 	// https://work.weixin.qq.com/api/doc/90000/90135/91039
-	client := http.Client{
-		Timeout: 5 * time.Second,
-	}
 	req, err := http.NewRequest("GET", fmt.Sprintf("https://qyapi.weixin.qq.com/cgi-bin/gettoken?corpid=%s&corpsecret=%s",
 		i.CorpId, i.AgentSecret), nil)
 	if err != nil {
 		common.SysError(err.Error())
 		return
 	}
-	responseData, err := client.Do(req)
+	responseData, err := getHTTPClient(nil).Do(req)
 	if err != nil {
 		common.SysError("failed to refresh access token: " + err.Error())
 		return
@@ -116,6 +109,7 @@ type wechatCorpMessageRequest struct {
 type wechatCorpMessageResponse struct {
 	ErrorCode    int    `json:"errcode"`
 	ErrorMessage string `json:"errmsg"`
+	MessageId    string `json:"msgid"`
 }
 
 func parseWechatCorpAccountAppId(appId string) (string, string, error) {
@@ -126,18 +120,23 @@ func parseWechatCorpAccountAppId(appId string) (string, string, error) {
 	return parts[0], parts[1], nil
 }
 
-func SendWeChatCorpMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+func validateWeChatCorpChannel(channel_ *model.Channel) error {
+	_, _, err := parseWechatCorpAccountAppId(channel_.AppId)
+	return err
+}
+
+// buildWeChatCorpPayload builds the request without the access token, which is added when sending.
+func buildWeChatCorpPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
     if message == nil || user == nil || channel_ == nil {
-        return errors.New("message, user or channel is nil")
+        return nil, errors.New("message, user or channel is nil")
     }
 	// https://developer.work.weixin.com/document/path/90236
-	corpId, agentId, err := parseWechatCorpAccountAppId(channel_.AppId)
+	_, agentId, err := parseWechatCorpAccountAppId(channel_.AppId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	userId := channel_.AccountId
 	clientType := channel_.Other
-	agentSecret := channel_.Secret
 	messageRequest := wechatCorpMessageRequest{
 		ToUser:  userId,
 		AgentId: agentId,
@@ -204,17 +203,27 @@ func SendWeChatCorpMessage(message *model.Message, user *model.User, channel_ *m
 		messageRequest.Markdown.Content = message.Content
 	}
 
-	jsonData, err := json.Marshal(messageRequest)
+	return &Payload{Method: http.MethodPost, URL: "https://qyapi.weixin.qq.com/cgi-bin/message/send", Body: messageRequest}, nil
+}
+
+func SendWeChatCorpMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildWeChatCorpPayload(message, user, channel_)
+	if err != nil {
+		return err
+	}
+	jsonData, err := payload.bodyBytes()
 	if err != nil {
 		return err
 	}
-	key := fmt.Sprintf("%s%s%s", corpId, agentId, agentSecret)
+	corpId, agentId, _ := parseWechatCorpAccountAppId(channel_.AppId)
+	key := fmt.Sprintf("%s%s%s", corpId, agentId, channel_.Secret)
 	accessToken := TokenStoreGetToken(key)
-	resp, err := http.Post(fmt.Sprintf("https://qyapi.weixin.qq.com/cgi-bin/message/send?access_token=%s", accessToken), "application/json",
+	resp, err := getHTTPClient(channel_).Post(fmt.Sprintf("%s?access_token=%s", payload.URL, accessToken), "application/json",
 		bytes.NewBuffer(jsonData))
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	var res wechatCorpMessageResponse
 	err = json.NewDecoder(resp.Body).Decode(&res)
 	if err != nil {
@@ -223,5 +232,21 @@ func SendWeChatCorpMessage(message *model.Message, user *model.User, channel_ *m
 	if res.ErrorCode != 0 {
 		return errors.New(res.ErrorMessage)
 	}
+	message.RemoteId = res.MessageId
 	return nil
 }
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeWeChatCorpAccount,
+		schema: []ConfigField{
+			{Column: ColumnAppId, Type: FieldTypeString, Label: "企业 ID 与应用 AgentId", Required: true},
+			{Column: ColumnSecret, Type: FieldTypeSecret, Label: "应用 Secret", Required: true},
+			{Column: ColumnAccountId, Type: FieldTypeString, Label: "用户账号", Required: true},
+			{Column: ColumnOther, Type: FieldTypeOptions, Label: "微信企业号客户端类型", Required: false, Options: []string{"plugin", "app"}},
+		},
+		send:     SendWeChatCorpMessage,
+		validate: validateWeChatCorpChannel,
+		preview:  buildWeChatCorpPayload,
+	})
+}
@@ -8,7 +8,7 @@ import (
 	"message-pusher/common"
 	"message-pusher/model"
 	"net/http"
-	"time"
+	"strconv"
 )
 
 type wechatTestAccountResponse struct {
@@ -29,10 +29,7 @@ func (i *WeChatTestAccountTokenStoreItem) Key() string {
 }
 
 func (i *WeChatTestAccountTokenStoreItem) IsShared() bool {
-	var count int64 = 0
-	model.DB.Model(&model.Channel{}).Where("secret = ? and app_id = ? and type = ?",
-		i.AppSecret, i.AppID, model.TypeWeChatTestAccount).Count(&count)
-	return count > 1
+	return model.CountChannelsBySecret(model.TypeWeChatTestAccount, i.AppID, i.AppSecret) > 1
 }
 
 func (i *WeChatTestAccountTokenStoreItem) IsFilled() bool {
@@ -45,16 +42,13 @@ func (i *WeChatTestAccountTokenStoreItem) Token() string {
 
 func (i *WeChatTestAccountTokenStoreItem) Refresh() {
 	// https://developers.weixin.qq.com/doc/offiaccount/Basic_Information/Get_access_token.html
-	client := http.Client{
-		Timeout: 5 * time.Second,
-	}
 	req, err := http.NewRequest("GET", fmt.Sprintf("https://api.weixin.qq.com/cgi-bin/token?grant_type=client_credential&appid=%s&secret=%s",
 		i.AppID, i.AppSecret), nil)
 	if err != nil {
 		common.SysError(err.Error())
 		return
 	}
-	responseData, err := client.Do(req)
+	responseData, err := getHTTPClient(nil).Do(req)
 	if err != nil {
 		common.SysError("failed to refresh access token: " + err.Error())
 		return
@@ -93,9 +87,11 @@ type wechatTestMessageRequest struct {
 type wechatTestMessageResponse struct {
 	ErrorCode    int    `json:"errcode"`
 	ErrorMessage string `json:"errmsg"`
+	MessageId    int64  `json:"msgid"`
 }
 
-func SendWeChatTestMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+// buildWeChatTestPayload builds the request without the access token, which is added when sending.
+func buildWeChatTestPayload(message *model.Message, user *model.User, channel_ *model.Channel) (*Payload, error) {
 	// https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Template_Message_Interface.html
 	values := wechatTestMessageRequest{
 		ToUser:     channel_.AccountId,
@@ -110,17 +106,26 @@ func SendWeChatTestMessage(message *model.Message, user *model.User, channel_ *m
 	values.Data.Description.Value = message.Description
 	values.Data.Content.Value = message.Content
 	values.URL = message.URL
-	jsonData, err := json.Marshal(values)
+	return &Payload{Method: http.MethodPost, URL: "https://api.weixin.qq.com/cgi-bin/message/template/send", Body: values}, nil
+}
+
+func SendWeChatTestMessage(message *model.Message, user *model.User, channel_ *model.Channel) error {
+	payload, err := buildWeChatTestPayload(message, user, channel_)
+	if err != nil {
+		return err
+	}
+	jsonData, err := payload.bodyBytes()
 	if err != nil {
 		return err
 	}
 	key := fmt.Sprintf("%s%s", channel_.AppId, channel_.Secret)
 	accessToken := TokenStoreGetToken(key)
-	resp, err := http.Post(fmt.Sprintf("https://api.weixin.qq.com/cgi-bin/message/template/send?access_token=%s", accessToken), "application/json",
+	resp, err := getHTTPClient(channel_).Post(fmt.Sprintf("%s?access_token=%s", payload.URL, accessToken), "application/json",
 		bytes.NewBuffer(jsonData))
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	var res wechatTestMessageResponse
 	err = json.NewDecoder(resp.Body).Decode(&res)
 	if err != nil {
@@ -129,5 +134,20 @@ func SendWeChatTestMessage(message *model.Message, user *model.User, channel_ *m
 	if res.ErrorCode != 0 {
 		return errors.New(res.ErrorMessage)
 	}
+	message.RemoteId = strconv.FormatInt(res.MessageId, 10)
 	return nil
 }
+
+func init() {
+	RegisterDriver(&driver{
+		type_: model.TypeWeChatTestAccount,
+		schema: []ConfigField{
+			{Column: ColumnAppId, Type: FieldTypeString, Label: "测试号 ID", Required: true},
+			{Column: ColumnSecret, Type: FieldTypeSecret, Label: "测试号密钥", Required: true},
+			{Column: ColumnOther, Type: FieldTypeString, Label: "测试模板 ID", Required: true},
+			{Column: ColumnAccountId, Type: FieldTypeString, Label: "用户 Open ID", Required: true},
+		},
+		send:    SendWeChatTestMessage,
+		preview: buildWeChatTestPayload,
+	})
+}
@@ -35,6 +35,18 @@ var RegisterEnabled = true
 var MessagePersistenceEnabled = true
 var MessageRenderEnabled = true
 
+// IdempotencyKeyWindow is how long a push's idempotency key is remembered, unit: second
+var IdempotencyKeyWindow = 24 * 3600
+
+// AlertDedupWindow is how long repeated triggers of an alert are suppressed after a notification, unit: second
+var AlertDedupWindow = 3600
+
+// OutboundAllowlist lists the internal hosts, IPs and CIDRs channels are allowed to connect to, separated by commas or new lines
+var OutboundAllowlist = ""
+
+// OutboundProxy is the default proxy of channels, e.g. socks5://127.0.0.1:1080
+var OutboundProxy = ""
+
 var SMTPServer = ""
 var SMTPPort = 587
 var SMTPAccount = ""
@@ -102,11 +114,24 @@ const (
 )
 
 const (
-	MessageSendStatusUnknown      = 0
-	MessageSendStatusPending      = 1
-	MessageSendStatusSent         = 2
-	MessageSendStatusFailed       = 3
-	MessageSendStatusAsyncPending = 4
+	MessageSendStatusUnknown       = 0
+	MessageSendStatusPending       = 1
+	MessageSendStatusSent          = 2
+	MessageSendStatusFailed        = 3
+	MessageSendStatusAsyncPending  = 4
+	MessageSendStatusPartiallySent = 5 // some targets of a group message failed
+	MessageSendStatusScheduled     = 6
+	MessageSendStatusCanceled      = 7 // scheduled but canceled before sent
+)
+
+// Message priorities, channels with their own levels map them to the closest ones.
+const (
+	MessagePriorityUnset  = 0 // the channel's default
+	MessagePriorityMin    = 1
+	MessagePriorityLow    = 2
+	MessagePriorityNormal = 3
+	MessagePriorityHigh   = 4
+	MessagePriorityUrgent = 5
 )
 
 const (
@@ -120,3 +145,40 @@ const (
 	WebhookStatusEnabled  = 1
 	WebhookStatusDisabled = 2
 )
+
+const (
+	WebhookVerifySchemeNone   = ""
+	WebhookVerifySchemeGitHub = "github" // X-Hub-Signature-256
+	WebhookVerifySchemeGitLab = "gitlab" // X-Gitlab-Token
+	WebhookVerifySchemeStripe = "stripe" // Stripe-Signature, timestamped HMAC
+	WebhookVerifySchemeHMAC   = "hmac"   // HMAC-SHA256 of the body in a custom header
+	WebhookVerifySchemeBearer = "bearer" // Authorization: Bearer <secret>
+)
+
+const (
+	ScheduledJobStatusUnknown  = 0
+	ScheduledJobStatusEnabled  = 1
+	ScheduledJobStatusDisabled = 2
+)
+
+const (
+	AlertStatusUnknown  = 0
+	AlertStatusFiring   = 1
+	AlertStatusResolved = 2
+)
+
+const (
+	AlertEventTrigger = "trigger"
+	AlertEventResolve = "resolve"
+)
+
+const (
+	ApiTokenStatusUnknown  = 0
+	ApiTokenStatusEnabled  = 1
+	ApiTokenStatusDisabled = 2
+)
+
+const (
+	ApiTokenScopePush   = "push"   // can only push messages
+	ApiTokenScopeManage = "manage" // can also call the management API
+)
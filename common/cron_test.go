@@ -0,0 +1,87 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronExpressionInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"30-10 * * * *",
+		"* * * FOO *",
+	}
+	for _, expr := range tests {
+		if _, err := ParseCronExpression(expr); err == nil {
+			t.Errorf("ParseCronExpression(%q) should fail", expr)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// 2024-01-01 is a Monday
+	from := time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", from, time.Date(2024, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", from, time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"5/15 * * * *", time.Date(2024, 1, 1, 10, 21, 0, 0, time.UTC), time.Date(2024, 1, 1, 10, 35, 0, 0, time.UTC)},
+		{"0,30 * * * *", from, time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", from, time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2024, 1, 1, 17, 0, 0, 0, time.UTC), time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", from, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 FEB *", from, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * MON-FRI", time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC), time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", from, time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", from, time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"@daily", from, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", from, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", from, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// both day fields restricted: either of them matches
+		{"0 0 13 * 5", from, time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2024, 1, 12, 1, 0, 0, 0, time.UTC), time.Date(2024, 1, 13, 0, 0, 0, 0, time.UTC)},
+		// one day field is a star: both of them must match
+		{"0 0 13 * *", from, time.Date(2024, 1, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 5", from, time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 */10 * 1", from, time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * */2", from, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 ? * 3", from, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		// never matches
+		{"0 0 30 2 *", from, time.Time{}},
+	}
+	for _, test := range tests {
+		schedule, err := ParseCronExpression(test.expr)
+		if err != nil {
+			t.Errorf("ParseCronExpression(%q) failed: %v", test.expr, err)
+			continue
+		}
+		if got := schedule.Next(test.from); !got.Equal(test.want) {
+			t.Errorf("%q.Next(%v) = %v, want %v", test.expr, test.from, got, test.want)
+		}
+	}
+}
+
+func TestCronScheduleNextLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	schedule, err := ParseCronExpression("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := schedule.Next(time.Date(2024, 1, 1, 9, 0, 0, 0, loc))
+	want := time.Date(2024, 1, 2, 9, 0, 0, 0, loc)
+	if !got.Equal(want) || got.Location() != loc {
+		t.Errorf("Next() = %v, want %v", got, want)
+	}
+}
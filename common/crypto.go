@@ -1,6 +1,18 @@
 package common
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"strings"
+)
 
 func Password2Hash(password string) (string, error) {
 	passwordBytes := []byte(password)
@@ -12,3 +24,182 @@ func ValidatePasswordAndHash(password string, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// HashToken returns the SHA-256 hash of a random token in hex, unlike passwords the token has enough entropy
+// to not need bcrypt, and the hash can be looked up directly.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Secrets stored in the database are protected with envelope encryption once a master key is configured:
+// every value is encrypted with its own random data key using AES-256-GCM, and the data key is encrypted
+// with the master key, so rotating the master key only needs to re-encrypt the data keys.
+// An encrypted value looks like enc:v1:<master key id>:<encrypted data key>:<encrypted value>.
+const encryptedSecretPrefix = "enc:v1:"
+
+var (
+	encryptionKeyId string
+	encryptionKeys  = make(map[string][]byte) // master key id -> master key, including old keys
+)
+
+func parseEncryptionKey(value string) (id string, key []byte) {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(value)))
+	key = sum[:]
+	idSum := sha256.Sum256(key)
+	return hex.EncodeToString(idSum[:4]), key
+}
+
+// InitEncryptionKeys loads the master key from ENCRYPTION_KEY or ENCRYPTION_KEY_FILE,
+// old keys which are still needed for decryption can be given in ENCRYPTION_OLD_KEYS, separated by commas.
+func InitEncryptionKeys() error {
+	value := os.Getenv("ENCRYPTION_KEY")
+	if path := os.Getenv("ENCRYPTION_KEY_FILE"); value == "" && path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read encryption key file: %s", err.Error())
+		}
+		value = string(content)
+	}
+	if strings.TrimSpace(value) == "" {
+		if os.Getenv("ENCRYPTION_OLD_KEYS") != "" {
+			return errors.New("ENCRYPTION_OLD_KEYS is set but ENCRYPTION_KEY is empty")
+		}
+		return nil
+	}
+	id, key := parseEncryptionKey(value)
+	encryptionKeyId = id
+	encryptionKeys[id] = key
+	for _, oldValue := range strings.Split(os.Getenv("ENCRYPTION_OLD_KEYS"), ",") {
+		if strings.TrimSpace(oldValue) == "" {
+			continue
+		}
+		id, key = parseEncryptionKey(oldValue)
+		encryptionKeys[id] = key
+	}
+	SysLog("secret encryption enabled, master key id: " + encryptionKeyId)
+	return nil
+}
+
+func IsEncryptionEnabled() bool {
+	return encryptionKeyId != ""
+}
+
+func sealWithKey(key []byte, plaintext []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func openWithKey(key []byte, ciphertext string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+// lookupEncryptedSecret splits value into the encrypted data key and the encrypted value, and finds its master key.
+func lookupEncryptedSecret(value string) (keyId string, key []byte, encryptedDataKey string, encryptedValue string, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, encryptedSecretPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, "", "", errors.New("invalid encrypted secret")
+	}
+	key, ok := encryptionKeys[parts[0]]
+	if !ok {
+		return "", nil, "", "", fmt.Errorf("missing encryption key %s to decrypt the secret", parts[0])
+	}
+	return parts[0], key, parts[1], parts[2], nil
+}
+
+func IsSecretEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedSecretPrefix)
+}
+
+// EncryptSecret encrypts value with a new data key, empty values and values when encryption is disabled are returned as is.
+func EncryptSecret(value string) (string, error) {
+	if !IsEncryptionEnabled() || value == "" || IsSecretEncrypted(value) {
+		return value, nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	encryptedDataKey, err := sealWithKey(encryptionKeys[encryptionKeyId], dataKey)
+	if err != nil {
+		return "", err
+	}
+	encryptedValue, err := sealWithKey(dataKey, []byte(value))
+	if err != nil {
+		return "", err
+	}
+	return encryptedSecretPrefix + encryptionKeyId + ":" + encryptedDataKey + ":" + encryptedValue, nil
+}
+
+// DecryptSecret decrypts value encrypted by EncryptSecret, values not encrypted are returned as is.
+func DecryptSecret(value string) (string, error) {
+	if !IsSecretEncrypted(value) {
+		return value, nil
+	}
+	_, key, encryptedDataKey, encryptedValue, err := lookupEncryptedSecret(value)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := openWithKey(key, encryptedDataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openWithKey(dataKey, encryptedValue)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// CheckSecretKey returns an error if the master key of the encrypted value is unavailable.
+func CheckSecretKey(value string) error {
+	_, _, _, _, err := lookupEncryptedSecret(value)
+	return err
+}
+
+// RewrapSecret re-encrypts the data key of value with the current master key,
+// ok is false if value is not encrypted or already uses the current master key.
+func RewrapSecret(value string) (rewrapped string, ok bool, err error) {
+	if !IsEncryptionEnabled() || !IsSecretEncrypted(value) {
+		return value, false, nil
+	}
+	keyId, key, encryptedDataKey, encryptedValue, err := lookupEncryptedSecret(value)
+	if err != nil || keyId == encryptionKeyId {
+		return value, false, err
+	}
+	dataKey, err := openWithKey(key, encryptedDataKey)
+	if err != nil {
+		return value, false, err
+	}
+	encryptedDataKey, err = sealWithKey(encryptionKeys[encryptionKeyId], dataKey)
+	if err != nil {
+		return value, false, err
+	}
+	return encryptedSecretPrefix + encryptionKeyId + ":" + encryptedDataKey + ":" + encryptedValue, true, nil
+}
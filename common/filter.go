@@ -0,0 +1,403 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Filter is a parsed boolean expression over string variables, e.g.
+//
+//	$action == 'opened' && $severity in ['critical', 'high']
+//
+// Supported operators: == != > >= < <= in, not in, contains, matches (regexp), && || ! and parentheses.
+// A bare variable is true if it's not empty, "0" or "false".
+// Comparisons are numeric when both sides are numbers.
+type Filter struct {
+	root filterNode
+}
+
+type filterNode interface {
+	eval(vars map[string]string) (bool, error)
+}
+
+type filterOperand struct {
+	variable string   // without $
+	value    string   // literal
+	list     []string // literal list, for in
+	isList   bool
+}
+
+func (o *filterOperand) resolve(vars map[string]string) string {
+	if o.variable != "" {
+		return vars[o.variable]
+	}
+	return o.value
+}
+
+type filterComparison struct {
+	left  filterOperand
+	op    string // empty means truthiness of left
+	right filterOperand
+	re    *regexp.Regexp
+}
+
+type filterLogic struct {
+	op    string // &&, ||, !
+	left  filterNode
+	right filterNode
+}
+
+func (n *filterLogic) eval(vars map[string]string) (bool, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	switch n.op {
+	case "!":
+		return !left, nil
+	case "&&":
+		if !left {
+			return false, nil
+		}
+	case "||":
+		if left {
+			return true, nil
+		}
+	}
+	return n.right.eval(vars)
+}
+
+func (n *filterComparison) eval(vars map[string]string) (bool, error) {
+	left := n.left.resolve(vars)
+	if n.op == "" {
+		return left != "" && left != "0" && left != "false", nil
+	}
+	switch n.op {
+	case "in", "not in":
+		found := false
+		if n.right.isList {
+			for _, item := range n.right.list {
+				if item == left {
+					found = true
+					break
+				}
+			}
+		} else {
+			// $var in $list, the list variable is comma separated
+			for _, item := range strings.Split(n.right.resolve(vars), ",") {
+				if strings.TrimSpace(item) == left {
+					found = true
+					break
+				}
+			}
+		}
+		return found == (n.op == "in"), nil
+	case "contains":
+		return strings.Contains(left, n.right.resolve(vars)), nil
+	case "matches":
+		return n.re.MatchString(left), nil
+	}
+	right := n.right.resolve(vars)
+	leftNumber, err1 := strconv.ParseFloat(left, 64)
+	rightNumber, err2 := strconv.ParseFloat(right, 64)
+	numeric := err1 == nil && err2 == nil
+	var cmp int
+	if numeric {
+		if leftNumber < rightNumber {
+			cmp = -1
+		} else if leftNumber > rightNumber {
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(left, right)
+	}
+	switch n.op {
+	case "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	}
+	return false, fmt.Errorf("不支持的运算符：%s", n.op)
+}
+
+// ParseFilter parses the expression, an empty expression matches everything.
+func ParseFilter(expr string) (*Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return &Filter{}, nil
+	}
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("过滤条件在「%s」附近有语法错误", p.tokens[p.pos].text)
+	}
+	return &Filter{root: root}, nil
+}
+
+func (f *Filter) Match(vars map[string]string) (bool, error) {
+	if f.root == nil {
+		return true, nil
+	}
+	return f.root.eval(vars)
+}
+
+// MatchFilter parses and evaluates the expression.
+func MatchFilter(expr string, vars map[string]string) (bool, error) {
+	filter, err := ParseFilter(expr)
+	if err != nil {
+		return false, err
+	}
+	return filter.Match(vars)
+}
+
+const (
+	filterTokenVariable = iota
+	filterTokenString
+	filterTokenNumber
+	filterTokenOperator
+	filterTokenWord
+)
+
+type filterToken struct {
+	kind int
+	text string
+}
+
+var filterComparisonOperators = map[string]bool{"==": true, "!=": true, ">": true, ">=": true, "<": true, "<=": true}
+
+var filterOperators = []string{"&&", "||", "==", "!=", ">=", "<=", ">", "<", "!", "(", ")", "[", "]", ","}
+
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(expr); {
+		ch := expr[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '$':
+			j := i + 1
+			for j < len(expr) && isFilterIdentChar(expr[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, errors.New("过滤条件中 $ 后缺少变量名")
+			}
+			tokens = append(tokens, filterToken{filterTokenVariable, expr[i+1 : j]})
+			i = j
+		case ch == '\'' || ch == '"':
+			var builder strings.Builder
+			j := i + 1
+			for ; j < len(expr) && expr[j] != ch; j++ {
+				if expr[j] == '\\' && j+1 < len(expr) {
+					j++
+				}
+				builder.WriteByte(expr[j])
+			}
+			if j >= len(expr) {
+				return nil, errors.New("过滤条件中的字符串缺少结束引号")
+			}
+			tokens = append(tokens, filterToken{filterTokenString, builder.String()})
+			i = j + 1
+		case ch == '-' || ch == '.' || (ch >= '0' && ch <= '9'):
+			j := i + 1
+			for j < len(expr) && (expr[j] == '.' || (expr[j] >= '0' && expr[j] <= '9')) {
+				j++
+			}
+			tokens = append(tokens, filterToken{filterTokenNumber, expr[i:j]})
+			i = j
+		case isFilterIdentChar(ch):
+			j := i + 1
+			for j < len(expr) && isFilterIdentChar(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, filterToken{filterTokenWord, expr[i:j]})
+			i = j
+		default:
+			matched := false
+			for _, op := range filterOperators {
+				if strings.HasPrefix(expr[i:], op) {
+					tokens = append(tokens, filterToken{filterTokenOperator, op})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("过滤条件中有无法识别的字符：%c", ch)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+func isFilterIdentChar(ch byte) bool {
+	return ch == '_' || ch == '.' || ch == '-' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() *filterToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *filterParser) accept(kind int, text string) bool {
+	token := p.peek()
+	if token != nil && token.kind == kind && token.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(filterTokenOperator, "||") || p.accept(filterTokenWord, "or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterLogic{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(filterTokenOperator, "&&") || p.accept(filterTokenWord, "and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterLogic{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (filterNode, error) {
+	if p.accept(filterTokenOperator, "!") || p.accept(filterTokenWord, "not") {
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &filterLogic{op: "!", left: node}, nil
+	}
+	if p.accept(filterTokenOperator, "(") {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(filterTokenOperator, ")") {
+			return nil, errors.New("过滤条件中的括号不匹配")
+		}
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	node := &filterComparison{left: *left}
+	token := p.peek()
+	if token == nil {
+		return node, nil
+	}
+	switch {
+	case token.kind == filterTokenOperator && filterComparisonOperators[token.text]:
+		node.op = token.text
+	case token.kind == filterTokenWord && (token.text == "in" || token.text == "contains" || token.text == "matches"):
+		node.op = token.text
+	case token.kind == filterTokenWord && token.text == "not" && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].text == "in":
+		node.op = "not in"
+		p.pos++
+	default:
+		return node, nil
+	}
+	p.pos++
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if right.isList && node.op != "in" && node.op != "not in" {
+		return nil, errors.New("列表只能用于 in 运算符")
+	}
+	node.right = *right
+	if node.op == "matches" {
+		if right.variable != "" {
+			return nil, errors.New("matches 运算符的右侧必须是正则表达式字符串")
+		}
+		node.re, err = regexp.Compile(right.value)
+		if err != nil {
+			return nil, fmt.Errorf("无效的正则表达式：%s", right.value)
+		}
+	}
+	return node, nil
+}
+
+func (p *filterParser) parseOperand() (*filterOperand, error) {
+	token := p.peek()
+	if token == nil {
+		return nil, errors.New("过滤条件不完整")
+	}
+	switch {
+	case token.kind == filterTokenVariable:
+		p.pos++
+		return &filterOperand{variable: token.text}, nil
+	case token.kind == filterTokenString || token.kind == filterTokenNumber:
+		p.pos++
+		return &filterOperand{value: token.text}, nil
+	case token.kind == filterTokenWord && (token.text == "true" || token.text == "false"):
+		p.pos++
+		return &filterOperand{value: token.text}, nil
+	case token.kind == filterTokenOperator && token.text == "[":
+		p.pos++
+		operand := &filterOperand{isList: true}
+		for !p.accept(filterTokenOperator, "]") {
+			if len(operand.list) > 0 && !p.accept(filterTokenOperator, ",") {
+				return nil, errors.New("过滤条件中的列表格式错误")
+			}
+			item := p.peek()
+			if item == nil {
+				return nil, errors.New("过滤条件中的列表缺少 ]")
+			}
+			if item.kind != filterTokenString && item.kind != filterTokenNumber && item.kind != filterTokenWord {
+				return nil, errors.New("过滤条件中的列表只能包含字符串或数字")
+			}
+			operand.list = append(operand.list, item.text)
+			p.pos++
+		}
+		return operand, nil
+	}
+	return nil, fmt.Errorf("过滤条件在「%s」附近有语法错误", token.text)
+}
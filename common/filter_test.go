@@ -0,0 +1,107 @@
+package common
+
+import "testing"
+
+func TestMatchFilter(t *testing.T) {
+	vars := map[string]string{
+		"action":         "opened",
+		"severity":       "high",
+		"count":          "9",
+		"zero":           "0",
+		"no":             "false",
+		"empty":          "",
+		"ref":            "refs/tags/v1.2.0",
+		"labels":         "bug, urgent,help wanted",
+		"pull_request.a": "1",
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"", true},
+		{"   ", true},
+		{"$action == 'opened'", true},
+		{"$action == \"closed\"", false},
+		{"$action != 'closed'", true},
+		// comparisons are numeric when both sides are numbers
+		{"$count < 10", true},
+		{"$count >= 10", false},
+		{"$count == 9.0", true},
+		{"$count > -1", true},
+		{"$action > 'a'", true},
+		{"$action <= 'b'", false},
+		// truthiness
+		{"$action", true},
+		{"$zero", false},
+		{"$no", false},
+		{"$empty", false},
+		{"$missing", false},
+		{"!$empty", true},
+		{"not $action", false},
+		// in and not in
+		{"$severity in ['critical', 'high']", true},
+		{"$severity in ['critical', 'low']", false},
+		{"$severity not in ['critical', 'high']", false},
+		{"$severity not in ['critical', 'low']", true},
+		{"$count in [1, 9]", true},
+		{"'urgent' in $labels", true},
+		{"'help wanted' in $labels", true},
+		{"'help' in $labels", false},
+		{"'help' not in $labels", true},
+		{"$missing in []", false},
+		{"$missing not in []", true},
+		// contains and matches
+		{"$ref contains 'tags'", true},
+		{"$ref contains 'heads'", false},
+		{"$ref matches '^refs/tags/v[0-9]+'", true},
+		// backslashes in strings escape the next character
+		{"$ref matches '^refs/tags/v\\\\d+\\.'", true},
+		{"$action == 'open\\ed'", true},
+		{"$ref matches '^v'", false},
+		{"$pull_request.a == 1", true},
+		// && binds tighter than ||
+		{"$action == 'opened' || $zero && $empty", true},
+		{"($action == 'opened' || $zero) && $empty", false},
+		{"$empty && $zero || $action", true},
+		{"$empty and $zero or $action", true},
+		// ! applies to the whole comparison after it
+		{"!$severity == 'high'", false},
+		{"!($severity == 'high') || $count == 9", true},
+		{"!!$action", true},
+		{"not ($severity in ['high'] && $count > 5)", false},
+	}
+	for _, test := range tests {
+		got, err := MatchFilter(test.expr, vars)
+		if err != nil {
+			t.Errorf("MatchFilter(%q) failed: %v", test.expr, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("MatchFilter(%q) = %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestParseFilterInvalid(t *testing.T) {
+	tests := []string{
+		"$",
+		"$action ==",
+		"$action == 'opened",
+		"($action",
+		"$action)",
+		"$action == 1 2",
+		"$action @ 1",
+		"$action == ['opened']",
+		"$action in ['opened' 'closed']",
+		"$action in ['opened',",
+		"$action in [$severity]",
+		"$ref matches '['",
+		"$ref matches $action",
+		"&& $action",
+	}
+	for _, expr := range tests {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Errorf("ParseFilter(%q) should fail", expr)
+		}
+	}
+}
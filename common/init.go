@@ -14,6 +14,8 @@ var (
 	PrintHelp    = flag.Bool("help", false, "Print the help message and exits.")
 	Port         = flag.Int("port", 3000, "Specify the listening port. Default is 3000.")
 	LogDir       = flag.String("log-dir", "", "Specify the directory for log files.")
+
+	RotateEncryptionKey = flag.Bool("rotate-encryption-key", false, "Re-encrypt secrets encrypted with old keys using the current ENCRYPTION_KEY and exits.")
 )
 
 func printHelp() {
@@ -31,6 +33,16 @@ func printHelp() {
 }
 
 func init() {
+	if os.Getenv("SESSION_SECRET") != "" {
+		SessionSecret = os.Getenv("SESSION_SECRET")
+	}
+	if os.Getenv("SQLITE_PATH") != "" {
+		SQLitePath = os.Getenv("SQLITE_PATH")
+	}
+}
+
+// ParseFlags parses the command line, it's called by main rather than init so that tests can have their own flags.
+func ParseFlags() {
 	flag.Parse()
 
 	if *PrintVersion {
@@ -42,12 +54,6 @@ func init() {
 		printHelp()
 	}
 
-	if os.Getenv("SESSION_SECRET") != "" {
-		SessionSecret = os.Getenv("SESSION_SECRET")
-	}
-	if os.Getenv("SQLITE_PATH") != "" {
-		SQLitePath = os.Getenv("SQLITE_PATH")
-	}
 	if *LogDir != "" {
 		var err error
 		*LogDir, err = filepath.Abs(*LogDir)
@@ -171,3 +171,18 @@ func Replace(s, old, new string, n int) string {
 	new = strings.TrimPrefix(strings.TrimSuffix(fmt.Sprintf("%q", new), "\""), "\"")
 	return strings.Replace(s, old, new, n)
 }
+
+// ParseOutboundAllowlist splits the allowlist by commas and new lines, empty entries are dropped.
+func ParseOutboundAllowlist(value string) []string {
+	entries := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	})
+	result := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry != "" {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
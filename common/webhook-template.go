@@ -0,0 +1,152 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// WebhookTemplateFuncs are the helpers available in webhook construct rule templates.
+var WebhookTemplateFuncs = template.FuncMap{
+	"date":       templateDate,
+	"truncate":   templateTruncate,
+	"default":    templateDefault,
+	"join":       templateJoin,
+	"toJSON":     templateToJSON,
+	"trimPrefix": templateTrimPrefix,
+	"firstLine":  templateFirstLine,
+}
+
+func ParseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("construct_rule").Funcs(WebhookTemplateFuncs).Parse(text)
+}
+
+// templateDate formats a unix timestamp (seconds or milliseconds) or a RFC 3339 time string, e.g. {{ date "2006-01-02 15:04" .body.time }}
+func templateDate(layout string, value interface{}) (string, error) {
+	var t time.Time
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case time.Time:
+		t = v
+	case float64:
+		t = unixToTime(int64(v))
+	case int:
+		t = unixToTime(int64(v))
+	case int64:
+		t = unixToTime(v)
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return "", err
+		}
+		t = unixToTime(n)
+	case string:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			t = unixToTime(n)
+			break
+		}
+		var err error
+		t, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			return "", fmt.Errorf("date: unsupported time %q", v)
+		}
+	default:
+		return "", fmt.Errorf("date: unsupported time %v", value)
+	}
+	return t.Local().Format(layout), nil
+}
+
+func unixToTime(n int64) time.Time {
+	if n > 1e12 {
+		return time.UnixMilli(n)
+	}
+	return time.Unix(n, 0)
+}
+
+// templateTruncate keeps the first n characters, e.g. {{ .body.message | truncate 100 }}
+func templateTruncate(n int, value interface{}) string {
+	s := templateToString(value)
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "..."
+}
+
+// templateDefault returns def if value is empty, e.g. {{ .body.level | default "info" }}
+func templateDefault(def interface{}, value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return def
+	case string:
+		if v == "" {
+			return def
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return def
+		}
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return def
+		}
+	}
+	return value
+}
+
+// templateJoin joins the items of a list, e.g. {{ join ", " .body.tags }}
+func templateJoin(sep string, value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []string:
+		return strings.Join(v, sep)
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, templateToString(item))
+		}
+		return strings.Join(items, sep)
+	}
+	return templateToString(value)
+}
+
+// templateToJSON encodes the value as JSON, use it to embed values in the construct rule safely,
+// e.g. {"title": {{ .body.title | toJSON }}}
+func templateToJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+// templateTrimPrefix e.g. {{ .vars.ref | trimPrefix "refs/heads/" }}
+func templateTrimPrefix(prefix string, value interface{}) string {
+	return strings.TrimPrefix(templateToString(value), prefix)
+}
+
+// templateFirstLine e.g. {{ firstLine .message }} for the subject of a commit message
+func templateFirstLine(value interface{}) string {
+	s := templateToString(value)
+	if idx := strings.IndexByte(s, '\n'); idx >= 0 {
+		return strings.TrimRight(s[:idx], "\r")
+	}
+	return s
+}
+
+func templateToString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,96 @@
+package common
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookTemplateFuncs(t *testing.T) {
+	// numbers are decoded as json.Number, the same as the webhook handler does
+	decoder := json.NewDecoder(strings.NewReader(`{
+		"title": "Build \"failed\"",
+		"message": "fix: typo\r\n\nlong description",
+		"level": "",
+		"tags": ["ci", "main", 3],
+		"empty_tags": [],
+		"meta": {"id": 1},
+		"ref": "refs/heads/main",
+		"time": 1704067200,
+		"time_ms": 1704067200123,
+		"time_str": "2024-01-01T00:00:00Z",
+		"zh": "你好世界"
+	}`))
+	decoder.UseNumber()
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{"body": body}
+	date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Local().Format("2006-01-02 15:04")
+	tests := []struct {
+		text string
+		want string
+	}{
+		{`{{ date "2006-01-02 15:04" .body.time }}`, date},
+		{`{{ date "2006-01-02 15:04" .body.time_ms }}`, date},
+		{`{{ date "2006-01-02 15:04" .body.time_str }}`, date},
+		{`{{ date "2006-01-02 15:04" "1704067200" }}`, date},
+		{`{{ date "2006-01-02" .body.missing }}`, ""},
+		{`{{ .body.zh | truncate 2 }}`, "你好..."},
+		{`{{ .body.zh | truncate 4 }}`, "你好世界"},
+		{`{{ .body.time | truncate 4 }}`, "1704..."},
+		{`{{ .body.level | default "info" }}`, "info"},
+		{`{{ .body.missing | default "info" }}`, "info"},
+		{`{{ .body.empty_tags | default "none" }}`, "none"},
+		{`{{ .body.ref | default "info" }}`, "refs/heads/main"},
+		{`{{ join ", " .body.tags }}`, "ci, main, 3"},
+		{`{{ join ", " .body.missing }}`, ""},
+		{`{{ join ", " .body.ref }}`, "refs/heads/main"},
+		{`{{ .body.title | toJSON }}`, `"Build \"failed\""`},
+		{`{{ .body.meta | toJSON }}`, `{"id":1}`},
+		{`{{ .body.missing | toJSON }}`, "null"},
+		{`{{ .body.ref | trimPrefix "refs/heads/" }}`, "main"},
+		{`{{ .body.ref | trimPrefix "refs/tags/" }}`, "refs/heads/main"},
+		{`{{ firstLine .body.message }}`, "fix: typo"},
+		{`{{ firstLine .body.ref }}`, "refs/heads/main"},
+		{`{{ .body.meta | truncate 20 }}`, `{"id":1}`},
+	}
+	for _, test := range tests {
+		tmpl, err := ParseWebhookTemplate(test.text)
+		if err != nil {
+			t.Errorf("ParseWebhookTemplate(%q) failed: %v", test.text, err)
+			continue
+		}
+		var builder strings.Builder
+		if err = tmpl.Execute(&builder, data); err != nil {
+			t.Errorf("executing %q failed: %v", test.text, err)
+			continue
+		}
+		if got := builder.String(); got != test.want {
+			t.Errorf("executing %q = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestWebhookTemplateErrors(t *testing.T) {
+	if _, err := ParseWebhookTemplate(`{{ unknown .body }}`); err == nil {
+		t.Error("ParseWebhookTemplate should fail for unknown functions")
+	}
+	tests := []string{
+		`{{ date "2006-01-02" "yesterday" }}`,
+		`{{ date "2006-01-02" .body }}`,
+	}
+	for _, text := range tests {
+		tmpl, err := ParseWebhookTemplate(text)
+		if err != nil {
+			t.Errorf("ParseWebhookTemplate(%q) failed: %v", text, err)
+			continue
+		}
+		var builder strings.Builder
+		if err = tmpl.Execute(&builder, map[string]interface{}{"body": map[string]interface{}{}}); err == nil {
+			t.Errorf("executing %q should fail", text)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"message-pusher/channel"
+	"message-pusher/common"
+	"message-pusher/model"
+	"net/http"
+	"time"
+)
+
+func validateAlertEvent(message *model.Message) error {
+	if message.DedupKey == "" {
+		if message.Event != "" {
+			return errors.New("设置 event 时必须同时设置 dedup_key")
+		}
+		return nil
+	}
+	if len(message.DedupKey) > 64 {
+		return errors.New("dedup_key 长度不能超过 64 个字符")
+	}
+	if message.Event == "" {
+		message.Event = common.AlertEventTrigger
+	}
+	if message.Event != common.AlertEventTrigger && message.Event != common.AlertEventResolve {
+		return errors.New("无效的 event：" + message.Event + "，仅支持 trigger 和 resolve")
+	}
+	return nil
+}
+
+// applyAlertEvent 根据告警状态决定消息是否需要发送，需要发送时会按照事件类型改写消息；
+// 发送前会先在数据库中原子地占用该告警，以免并发的请求重复发送
+func applyAlertEvent(message *model.Message, user *model.User) (alert *model.Alert, suppressed bool, err error) {
+	alert, err = model.GetAlertByDedupKey(user.Id, message.DedupKey)
+	if err != nil {
+		return nil, false, err
+	}
+	now := common.GetTimestamp()
+	if message.Event == common.AlertEventResolve {
+		if alert == nil || alert.Status != common.AlertStatusFiring {
+			return alert, true, nil
+		}
+		resolved, err := alert.Resolve(now)
+		if err != nil {
+			return nil, false, err
+		}
+		if !resolved || (alert.LastSentTime == 0 && alert.SendingTime == 0) {
+			// Resolved by another request, or nobody has been notified, so there is nothing to resolve.
+			return alert, true, nil
+		}
+		buildAlertResolvedMessage(message, alert)
+		return alert, false, nil
+	}
+	if alert == nil {
+		alert = &model.Alert{
+			UserId:      user.Id,
+			DedupKey:    message.DedupKey,
+			Status:      common.AlertStatusFiring,
+			Title:       message.Title,
+			Count:       1,
+			FirstTime:   now,
+			LastTime:    now,
+			SendingTime: now,
+		}
+		// The unique index of the user and the key makes sure only one request creates the alert.
+		err = alert.Insert()
+		if err == nil {
+			return alert, false, nil
+		}
+		// Another request with the same key has created the alert.
+		alert, err = model.GetAlertByDedupKey(user.Id, message.DedupKey)
+		if err != nil || alert == nil {
+			return nil, false, errors.New("保存告警失败")
+		}
+	}
+	if alert.Status != common.AlertStatusFiring {
+		refired, err := alert.Refire(message.Title, now)
+		if err != nil {
+			return nil, false, err
+		}
+		if refired {
+			return alert, false, nil
+		}
+		// Another request has restarted the alert, count this one as a repeated trigger.
+	}
+	err = alert.IncreaseCount(now)
+	if err != nil {
+		return nil, false, err
+	}
+	reserved, err := alert.ReserveSend(now, int64(common.AlertDedupWindow))
+	if err != nil {
+		return nil, false, err
+	}
+	if !reserved {
+		return alert, true, nil
+	}
+	if alert.Count > 1 {
+		message.Title = fmt.Sprintf("%s（已触发 %d 次）", message.Title, alert.Count)
+	}
+	return alert, false, nil
+}
+
+func buildAlertResolvedMessage(message *model.Message, alert *model.Alert) {
+	title := message.Title
+	if title == "" || title == common.SystemName {
+		title = alert.Title
+	}
+	message.Title = "已恢复：" + title
+	firstTime := time.Unix(alert.FirstTime, 0).Format("2006-01-02 15:04:05")
+	summary := fmt.Sprintf("该告警首次触发于 %s，共触发 %d 次。", firstTime, alert.Count)
+	if message.Description == "" {
+		message.Description = summary
+	}
+	if alert.MessageLink != "" && alert.MessageLink != "unsaved" {
+		summary += fmt.Sprintf("\n\n[原告警](%s/message/%s)", common.ServerAddress, alert.MessageLink)
+	}
+	if message.Content == "" {
+		message.Content = summary
+	} else {
+		message.Content += "\n\n" + summary
+	}
+}
+
+// completeAlertEvent 消息发送后更新告警状态，发送失败时释放占用，以便下一次触发时重新发送；
+// 异步与定时消息在实际发送后才会被记为已发送
+func completeAlertEvent(message *model.Message, alert *model.Alert, sendErr error) {
+	failed := sendErr != nil && !channel.IsPartialSendError(sendErr)
+	var err error
+	if message.Event == common.AlertEventResolve {
+		if failed {
+			err = alert.CancelResolve()
+		}
+	} else if failed {
+		err = alert.ReleaseSend()
+	} else if message.Async || message.SendAt > common.GetTimestamp() {
+		sendAt := message.SendAt
+		if sendAt < alert.SendingTime {
+			sendAt = alert.SendingTime
+		}
+		err = alert.DeferSend(message.Link, sendAt)
+		if err == nil {
+			// The sender may have finished before the link is recorded.
+			var status int
+			status, err = model.GetMessageStatusByLink(message.Link)
+			if err == nil && (status == common.MessageSendStatusSent || status == common.MessageSendStatusPartiallySent ||
+				status == common.MessageSendStatusFailed) {
+				err = model.CompleteAlertSendByLink(alert.UserId, message.Link,
+					status != common.MessageSendStatusFailed, common.GetTimestamp())
+			}
+		}
+	} else {
+		err = alert.CompleteSend(message.Link, common.GetTimestamp())
+	}
+	if err != nil {
+		common.SysError("failed to update alert: " + err.Error())
+	}
+}
+
+// respondSuppressedAlert 返回被抑制的告警消息，uuid 为该告警最近一次发送的消息
+func respondSuppressedAlert(c *gin.Context, message *model.Message, user *model.User, alert *model.Alert) {
+	link := ""
+	count := 0
+	if alert != nil {
+		link = alert.MessageLink
+		if alert.SendingLink != "" {
+			// the latest notification is waiting to be sent
+			link = alert.SendingLink
+		}
+		count = alert.Count
+	}
+	if message.IdempotencyKey != "" {
+		var err error
+		if link == "" {
+			err = model.ReleaseIdempotencyKey(user.Id, message.IdempotencyKey)
+		} else {
+			err = model.CompleteIdempotencyKey(user.Id, message.IdempotencyKey, link, common.MessageSendStatusSent)
+		}
+		if err != nil {
+			common.SysError("failed to save idempotency key: " + err.Error())
+		}
+	}
+	errorMessage := "重复的告警已被抑制"
+	if message.Event == common.AlertEventResolve {
+		errorMessage = "没有需要恢复的告警，已忽略"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"message":    errorMessage,
+		"uuid":       link,
+		"suppressed": true,
+		"count":      count,
+	})
+}
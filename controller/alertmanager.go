@@ -0,0 +1,308 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"io"
+	"message-pusher/model"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// alertmanagerPayload is the body of Alertmanager's webhook receiver (version 4).
+// See: https://prometheus.io/docs/alerting/latest/configuration/#webhook_config
+type alertmanagerPayload struct {
+	Version           string              `json:"version"`
+	GroupKey          string              `json:"groupKey"`
+	TruncatedAlerts   int                 `json:"truncatedAlerts"`
+	Status            string              `json:"status"` // firing, resolved
+	Receiver          string              `json:"receiver"`
+	GroupLabels       map[string]string   `json:"groupLabels"`
+	CommonLabels      map[string]string   `json:"commonLabels"`
+	CommonAnnotations map[string]string   `json:"commonAnnotations"`
+	ExternalURL       string              `json:"externalURL"`
+	Alerts            []alertmanagerAlert `json:"alerts"`
+}
+
+type alertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+const alertmanagerTimeFormat = "2006-01-02 15:04:05"
+
+func getAlertmanagerStatusText(status string) string {
+	if status == "resolved" {
+		return "已恢复"
+	}
+	return "告警"
+}
+
+// getAlertmanagerTitle 例如：[告警][critical] HighCPUUsage
+func getAlertmanagerTitle(status string, labels map[string]string) string {
+	title := "[" + status + "]"
+	if severity := labels["severity"]; severity != "" {
+		title += "[" + severity + "]"
+	}
+	name := labels["alertname"]
+	if name == "" {
+		name = "Alertmanager"
+	}
+	return title + " " + name
+}
+
+func getAlertmanagerSummary(annotations map[string]string) string {
+	if annotations["summary"] != "" {
+		return annotations["summary"]
+	}
+	return annotations["description"]
+}
+
+func renderAlertmanagerAlert(alert *alertmanagerAlert) string {
+	var builder strings.Builder
+	name := alert.Labels["alertname"]
+	if name == "" {
+		name = alert.Fingerprint
+	}
+	builder.WriteString(fmt.Sprintf("**%s**（%s）\n", name, getAlertmanagerStatusText(alert.Status)))
+	if alert.Labels["severity"] != "" {
+		builder.WriteString(fmt.Sprintf("- 级别：%s\n", alert.Labels["severity"]))
+	}
+	if !alert.StartsAt.IsZero() {
+		builder.WriteString(fmt.Sprintf("- 开始时间：%s\n", alert.StartsAt.Local().Format(alertmanagerTimeFormat)))
+	}
+	if alert.Status == "resolved" && !alert.EndsAt.IsZero() {
+		builder.WriteString(fmt.Sprintf("- 恢复时间：%s\n", alert.EndsAt.Local().Format(alertmanagerTimeFormat)))
+	}
+	if alert.Annotations["summary"] != "" {
+		builder.WriteString(fmt.Sprintf("- 摘要：%s\n", alert.Annotations["summary"]))
+	}
+	if alert.Annotations["description"] != "" {
+		builder.WriteString(fmt.Sprintf("- 描述：%s\n", alert.Annotations["description"]))
+	}
+	keys := make([]string, 0, len(alert.Labels))
+	for key := range alert.Labels {
+		if key != "alertname" && key != "severity" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		labels := make([]string, 0, len(keys))
+		for _, key := range keys {
+			labels = append(labels, fmt.Sprintf("%s=%s", key, alert.Labels[key]))
+		}
+		builder.WriteString(fmt.Sprintf("- 标签：%s\n", strings.Join(labels, ", ")))
+	}
+	if alert.GeneratorURL != "" {
+		builder.WriteString(fmt.Sprintf("- [查看详情](%s)\n", alert.GeneratorURL))
+	}
+	return builder.String()
+}
+
+// buildAlertmanagerGroupMessage 将整组告警渲染为一条消息
+func buildAlertmanagerGroupMessage(payload *alertmanagerPayload, channel string) *model.Message {
+	firing := 0
+	for _, alert := range payload.Alerts {
+		if alert.Status != "resolved" {
+			firing++
+		}
+	}
+	resolved := len(payload.Alerts) - firing
+	status := getAlertmanagerStatusText(payload.Status)
+	if firing > 0 && resolved > 0 {
+		status = fmt.Sprintf("告警 %d 条，已恢复 %d 条", firing, resolved)
+	} else if len(payload.Alerts) > 1 {
+		status = fmt.Sprintf("%s %d 条", status, len(payload.Alerts))
+	}
+	contents := make([]string, 0, len(payload.Alerts)+1)
+	for i := range payload.Alerts {
+		contents = append(contents, renderAlertmanagerAlert(&payload.Alerts[i]))
+	}
+	if payload.TruncatedAlerts > 0 {
+		contents = append(contents, fmt.Sprintf("另有 %d 条告警未展示", payload.TruncatedAlerts))
+	}
+	return &model.Message{
+		Channel:     channel,
+		Title:       getAlertmanagerTitle(status, payload.CommonLabels),
+		Description: getAlertmanagerSummary(payload.CommonAnnotations),
+		Content:     strings.Join(contents, "\n"),
+		URL:         payload.ExternalURL,
+	}
+}
+
+func buildAlertmanagerAlertMessage(alert *alertmanagerAlert, channel string) *model.Message {
+	return &model.Message{
+		Channel:     channel,
+		Title:       getAlertmanagerTitle(getAlertmanagerStatusText(alert.Status), alert.Labels),
+		Description: getAlertmanagerSummary(alert.Annotations),
+		Content:     renderAlertmanagerAlert(alert),
+		URL:         alert.GeneratorURL,
+	}
+}
+
+// getAlertmanagerVariables 返回用于过滤条件与路由的变量，包括提取规则提取的变量、告警状态 status 以及各个标签，
+// 合并发送时标签取自整组告警的公共标签，拆分发送时取自每条告警，提取规则也作用于每条告警
+func getAlertmanagerVariables(webhook *model.Webhook, reqText string, status string, labels map[string]string) (map[string]string, error) {
+	vars := make(map[string]string)
+	if webhook.ExtractRule != "" {
+		var err error
+		vars, err = extractWebhookVariables(webhook, reqText)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range labels {
+		if _, ok := vars[key]; !ok {
+			vars[key] = value
+		}
+	}
+	if _, ok := vars["status"]; !ok {
+		vars["status"] = status
+	}
+	return vars, nil
+}
+
+// TriggerAlertmanagerWebhook 接收 Prometheus Alertmanager 的 Webhook 通知，使用 Webhook 配置的通道发送，
+// 默认整组告警合并为一条消息，设置 split=true 时每条告警单独发送一条消息
+func TriggerAlertmanagerWebhook(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	reqText := string(body)
+	webhook, user, ok := getTriggeredWebhook(c)
+	if !ok {
+		return
+	}
+	// Alertmanager supports bearer tokens via http_config.authorization
+	err = verifyWebhookRequest(webhook, c.Request.Header, body)
+	if err != nil {
+		record := &model.WebhookRequest{Error: err.Error(), Endpoint: model.WebhookEndpointAlertmanager}
+		recordWebhookRequest(webhook, record, c.Request.Header, c.Request.URL.RawQuery, reqText)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	record := executeAlertmanagerWebhook(c, webhook, user, reqText, c.Request.URL.Query())
+	recordWebhookRequest(webhook, record, c.Request.Header, c.Request.URL.RawQuery, reqText)
+}
+
+// executeAlertmanagerWebhook 与普通 Webhook 一样经过过滤条件与路由后推送告警，返回用于记录的请求处理结果
+func executeAlertmanagerWebhook(c *gin.Context, webhook *model.Webhook, user *model.User, reqText string, query url.Values) *model.WebhookRequest {
+	record := &model.WebhookRequest{Endpoint: model.WebhookEndpointAlertmanager}
+	payload := alertmanagerPayload{}
+	err := json.Unmarshal([]byte(reqText), &payload)
+	if err != nil {
+		record.Error = "无法解析 Alertmanager 请求体"
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": record.Error,
+		})
+		return record
+	}
+	if len(payload.Alerts) == 0 {
+		record.Skipped = true
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "没有需要发送的告警",
+		})
+		return record
+	}
+	if query.Get("split") != "true" {
+		vars, err := getAlertmanagerVariables(webhook, reqText, payload.Status, payload.CommonLabels)
+		channel_ := ""
+		matched := false
+		if err == nil {
+			record.Variables = vars
+			channel_, matched, err = matchWebhookRoute(webhook, vars)
+		}
+		if err != nil {
+			record.Error = err.Error()
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return record
+		}
+		if !matched {
+			record.Skipped = true
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"message": "请求不满足 Webhook 的过滤条件，已忽略",
+				"skipped": true,
+			})
+			return record
+		}
+		message := buildAlertmanagerGroupMessage(&payload, channel_)
+		err = processMessage(c, message, user, false)
+		record.MessageLink = message.Link
+		if err != nil {
+			record.Error = err.Error()
+		}
+		return record
+	}
+	results := make([]gin.H, 0, len(payload.Alerts))
+	failed := 0
+	skipped := 0
+	var errorMessages []string
+	for i := range payload.Alerts {
+		alert := &payload.Alerts[i]
+		vars, err := getAlertmanagerVariables(webhook, gjson.Get(reqText, fmt.Sprintf("alerts.%d", i)).Raw, alert.Status, alert.Labels)
+		channel_ := ""
+		matched := false
+		if err == nil {
+			channel_, matched, err = matchWebhookRoute(webhook, vars)
+		}
+		result := gin.H{}
+		if err == nil && !matched {
+			skipped++
+			result["skipped"] = true
+			results = append(results, result)
+			continue
+		}
+		if err == nil {
+			message := buildAlertmanagerAlertMessage(alert, channel_)
+			err = sendMessage(message, user)
+			result["uuid"] = message.Link
+			if record.MessageLink == "" {
+				// only the first message is recorded
+				record.MessageLink = message.Link
+			}
+		}
+		if err != nil {
+			failed++
+			result["error"] = err.Error()
+			errorMessages = append(errorMessages, err.Error())
+		}
+		results = append(results, result)
+	}
+	record.Skipped = skipped == len(payload.Alerts)
+	record.Error = strings.Join(errorMessages, "\n")
+	errorMessage := ""
+	if failed > 0 {
+		errorMessage = fmt.Sprintf("%d 条告警中有 %d 条发送失败", len(payload.Alerts), failed)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": failed == 0,
+		"message": errorMessage,
+		"data":    results,
+	})
+	return record
+}
@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"message-pusher/common"
+	"message-pusher/model"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func validateApiToken(token *model.ApiToken) error {
+	if len(token.Name) == 0 || len(token.Name) > 20 {
+		return errors.New("令牌名称长度必须在1-20之间")
+	}
+	if token.Status != common.ApiTokenStatusEnabled && token.Status != common.ApiTokenStatusDisabled {
+		return errors.New("无效的令牌状态")
+	}
+	if token.Scope != common.ApiTokenScopePush && token.Scope != common.ApiTokenScopeManage {
+		return errors.New("无效的令牌权限范围：" + token.Scope)
+	}
+	if token.ExpiredTime < 0 {
+		return errors.New("无效的过期时间")
+	}
+	if token.Scope == common.ApiTokenScopeManage && len(token.AllowedChannels) > 0 {
+		// the management API can read and edit every channel, the restriction couldn't be honoured
+		return errors.New("具有管理权限的令牌不能限制可用通道")
+	}
+	for _, name := range token.AllowedChannels {
+		_, err := model.GetChannelByName(name, token.UserId)
+		if err != nil {
+			return errors.New("无效的渠道名称：" + name)
+		}
+	}
+	for _, subnet := range token.AllowedSubnets {
+		if _, _, err := net.ParseCIDR(subnet); err != nil && net.ParseIP(subnet) == nil {
+			return fmt.Errorf("无效的 IP 地址或网段：%s", subnet)
+		}
+	}
+	return nil
+}
+
+func GetAllApiTokens(c *gin.Context) {
+	userId := c.GetInt("id")
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	tokens, err := model.GetApiTokensByUserId(userId, p*common.ItemsPerPage, common.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    tokens,
+	})
+	return
+}
+
+func GetApiToken(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt("id")
+	token, err := model.GetApiTokenById(id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    token,
+	})
+	return
+}
+
+// AddApiToken 创建令牌，令牌的值只会在创建时返回
+func AddApiToken(c *gin.Context) {
+	token := model.ApiToken{}
+	err := c.ShouldBindJSON(&token)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	key := common.GetUUID()
+	cleanToken := model.ApiToken{
+		UserId:          c.GetInt("id"),
+		Name:            token.Name,
+		Key:             common.HashToken(key),
+		Status:          common.ApiTokenStatusEnabled,
+		Scope:           token.Scope,
+		ExpiredTime:     token.ExpiredTime,
+		AllowedChannels: token.AllowedChannels,
+		AllowedSubnets:  token.AllowedSubnets,
+		CreatedTime:     common.GetTimestamp(),
+	}
+	if cleanToken.Scope == "" {
+		cleanToken.Scope = common.ApiTokenScopePush
+	}
+	err = validateApiToken(&cleanToken)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = cleanToken.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// only the hash is stored, so the key can't be shown again
+	cleanToken.Key = key
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanToken,
+	})
+	return
+}
+
+func DeleteApiToken(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt("id")
+	err := model.DeleteApiTokenById(id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+func UpdateApiToken(c *gin.Context) {
+	userId := c.GetInt("id")
+	statusOnly := c.Query("status_only")
+	token := model.ApiToken{}
+	err := c.ShouldBindJSON(&token)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	oldToken, err := model.GetApiTokenById(token.Id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanToken := *oldToken
+	if statusOnly != "" {
+		cleanToken.Status = token.Status
+	} else {
+		// If you add more fields, please also update token.Update()
+		cleanToken.Name = token.Name
+		cleanToken.Status = token.Status
+		cleanToken.Scope = token.Scope
+		cleanToken.ExpiredTime = token.ExpiredTime
+		cleanToken.AllowedChannels = token.AllowedChannels
+		cleanToken.AllowedSubnets = token.AllowedSubnets
+		err = validateApiToken(&cleanToken)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	err = cleanToken.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanToken,
+	})
+	return
+}
+
+// authApiToken 如果推送使用的是用户的 API 令牌，则校验令牌的限制，返回值 ok 表示是否使用了 API 令牌；
+// 群组消息的各个子通道也需要在令牌允许使用的通道内
+func authApiToken(c *gin.Context, message *model.Message, user *model.User, channel_ *model.Channel) (ok bool, err error) {
+	token := model.GetApiTokenByKey(message.Token)
+	if token == nil || token.UserId != user.Id {
+		return false, nil
+	}
+	channels := []string{channel_.Name}
+	if channel_.Type == model.TypeGroup {
+		channels = append(channels, strings.Split(channel_.AppId, "|")...)
+	}
+	err = token.Verify(c.ClientIP(), channels...)
+	if err != nil {
+		return true, err
+	}
+	err = token.UpdateLastUsedTime()
+	if err != nil {
+		common.SysError("failed to update the last used time of api token: " + err.Error())
+	}
+	return true, nil
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"message-pusher/common"
+	"message-pusher/model"
+	"net/http/httptest"
+	"testing"
+)
+
+func openTestDB(t *testing.T, models ...interface{}) {
+	// Redis is enabled until the client is initialized
+	common.RedisEnabled = false
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection has its own in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(models...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.DB = db
+	t.Cleanup(func() {
+		_ = sqlDB.Close()
+	})
+}
+
+func TestValidateApiTokenScope(t *testing.T) {
+	tests := []struct {
+		token model.ApiToken
+		valid bool
+	}{
+		{model.ApiToken{Name: "ci", Status: common.ApiTokenStatusEnabled, Scope: common.ApiTokenScopePush}, true},
+		{model.ApiToken{Name: "ci", Status: common.ApiTokenStatusEnabled, Scope: common.ApiTokenScopeManage}, true},
+		{model.ApiToken{Name: "ci", Status: common.ApiTokenStatusEnabled, Scope: common.ApiTokenScopeManage, AllowedChannels: []string{"lark"}}, false},
+		{model.ApiToken{Name: "ci", Status: common.ApiTokenStatusEnabled, Scope: "admin"}, false},
+		{model.ApiToken{Name: "ci", Status: common.ApiTokenStatusEnabled, Scope: common.ApiTokenScopePush, AllowedSubnets: []string{"10.0.0.0/33"}}, false},
+	}
+	for _, test := range tests {
+		err := validateApiToken(&test.token)
+		if (err == nil) != test.valid {
+			t.Errorf("validateApiToken(scope %q, channels %v, subnets %v) = %v", test.token.Scope, test.token.AllowedChannels, test.token.AllowedSubnets, err)
+		}
+	}
+}
+
+func TestAuthApiTokenChannels(t *testing.T) {
+	openTestDB(t, &model.ApiToken{})
+	const key = "0123456789abcdef0123456789abcdef"
+	token := model.ApiToken{
+		UserId:          1,
+		Name:            "ci",
+		Key:             common.HashToken(key),
+		Status:          common.ApiTokenStatusEnabled,
+		Scope:           common.ApiTokenScopePush,
+		AllowedChannels: []string{"lark", "email"},
+	}
+	if err := token.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	user := &model.User{Id: 1}
+	tests := []struct {
+		channel model.Channel
+		valid   bool
+	}{
+		{model.Channel{Name: "lark", Type: model.TypeLark}, true},
+		{model.Channel{Name: "telegram", Type: model.TypeTelegram}, false},
+		{model.Channel{Name: "email", Type: model.TypeGroup, AppId: "lark|email"}, true},
+		{model.Channel{Name: "email", Type: model.TypeGroup, AppId: "lark|telegram"}, false},
+	}
+	for _, test := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/push/root", nil)
+		ok, err := authApiToken(c, &model.Message{Token: key}, user, &test.channel)
+		if !ok {
+			t.Fatalf("the api token isn't recognized")
+		}
+		if (err == nil) != test.valid {
+			t.Errorf("authApiToken(channel %q, sub-channels %q) = %v", test.channel.Name, test.channel.AppId, err)
+		}
+	}
+
+	// the token belongs to another user
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/push/other", nil)
+	ok, _ := authApiToken(c, &model.Message{Token: key}, &model.User{Id: 2}, &model.Channel{Name: "lark"})
+	if ok {
+		t.Errorf("the api token of another user shouldn't be accepted")
+	}
+}
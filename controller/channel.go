@@ -99,6 +99,44 @@ func GetChannel(c *gin.Context) {
 	return
 }
 
+func GetChannelTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    channel.GetDriverInfos(),
+	})
+	return
+}
+
+func TestChannel(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt("id")
+	helper := func() error {
+		channel_, err := model.GetChannelById(id, userId, true)
+		if err != nil {
+			return err
+		}
+		user, err := model.GetUserById(userId, true)
+		if err != nil {
+			return err
+		}
+		return channel.TestChannel(user, channel_)
+	}
+	err := helper()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
 func AddChannel(c *gin.Context) {
 	channel_ := model.Channel{}
 	err := c.ShouldBindJSON(&channel_)
@@ -136,6 +174,16 @@ func AddChannel(c *gin.Context) {
 		Other:       channel_.Other,
 		CreatedTime: common.GetTimestamp(),
 		Token:       channel_.Token,
+		RetryPolicy: channel_.RetryPolicy,
+		Proxy:       channel_.Proxy,
+	}
+	err = channel.ValidateChannel(&cleanChannel)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
 	}
 	err = cleanChannel.Insert()
 	if err != nil {
@@ -208,6 +256,16 @@ func UpdateChannel(c *gin.Context) {
 		cleanChannel.URL = channel_.URL
 		cleanChannel.Other = channel_.Other
 		cleanChannel.Token = channel_.Token
+		cleanChannel.RetryPolicy = channel_.RetryPolicy
+		cleanChannel.Proxy = channel_.Proxy
+		err = channel.ValidateChannel(&cleanChannel)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	}
 	err = cleanChannel.Update()
 	if err != nil {
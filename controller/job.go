@@ -0,0 +1,372 @@
+package controller
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"message-pusher/channel"
+	"message-pusher/common"
+	"message-pusher/model"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var ScheduledJobSchedulerInterval = 5 * time.Second
+
+// getJobNextRunTime 根据 cron 表达式与时区计算 after 之后的下一次运行时间，无下一次运行时返回 0
+func getJobNextRunTime(job *model.ScheduledJob, after time.Time) (int64, error) {
+	schedule, err := common.ParseCronExpression(job.CronExpression)
+	if err != nil {
+		return 0, err
+	}
+	loc := time.Local
+	if job.Timezone != "" {
+		loc, err = time.LoadLocation(job.Timezone)
+		if err != nil {
+			return 0, errors.New("无效的时区：" + job.Timezone)
+		}
+	}
+	next := schedule.Next(after.In(loc))
+	if next.IsZero() {
+		return 0, nil
+	}
+	return next.Unix(), nil
+}
+
+func validateScheduledJob(job *model.ScheduledJob) error {
+	if len(job.Name) == 0 || len(job.Name) > 20 {
+		return errors.New("任务名称长度必须在1-20之间")
+	}
+	nextRunTime, err := getJobNextRunTime(job, time.Now())
+	if err != nil {
+		return err
+	}
+	if nextRunTime == 0 {
+		return errors.New("该 cron 表达式在未来五年内不会触发")
+	}
+	if job.Channel != "" {
+		_, err = model.GetChannelByName(job.Channel, job.UserId)
+		if err != nil {
+			return errors.New("无效的渠道名称：" + job.Channel)
+		}
+	}
+	return nil
+}
+
+func GetAllScheduledJobs(c *gin.Context) {
+	userId := c.GetInt("id")
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	jobs, err := model.GetScheduledJobsByUserId(userId, p*common.ItemsPerPage, common.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    jobs,
+	})
+	return
+}
+
+func GetScheduledJob(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt("id")
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	job, err := model.GetScheduledJobById(id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    job,
+	})
+	return
+}
+
+func GetScheduledJobRuns(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt("id")
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	_, err := model.GetScheduledJobById(id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	runs, err := model.GetScheduledJobRunsByJobId(id, p*common.ItemsPerPage, common.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    runs,
+	})
+	return
+}
+
+func AddScheduledJob(c *gin.Context) {
+	job := model.ScheduledJob{}
+	err := c.ShouldBindJSON(&job)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanJob := model.ScheduledJob{
+		UserId:         c.GetInt("id"),
+		Name:           job.Name,
+		Status:         common.ScheduledJobStatusEnabled,
+		CronExpression: job.CronExpression,
+		Timezone:       job.Timezone,
+		Channel:        job.Channel,
+		Title:          job.Title,
+		Description:    job.Description,
+		Content:        job.Content,
+		URL:            job.URL,
+		To:             job.To,
+		RenderMode:     job.RenderMode,
+		CreatedTime:    common.GetTimestamp(),
+	}
+	err = validateScheduledJob(&cleanJob)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanJob.NextRunTime, _ = getJobNextRunTime(&cleanJob, time.Now())
+	err = cleanJob.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanJob,
+	})
+	return
+}
+
+func DeleteScheduledJob(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt("id")
+	_, err := model.DeleteScheduledJobById(id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+func UpdateScheduledJob(c *gin.Context) {
+	userId := c.GetInt("id")
+	statusOnly := c.Query("status_only")
+	job := model.ScheduledJob{}
+	err := c.ShouldBindJSON(&job)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	oldJob, err := model.GetScheduledJobById(job.Id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanJob := *oldJob
+	if statusOnly != "" {
+		cleanJob.Status = job.Status
+	} else {
+		// If you add more fields, please also update job.Update()
+		cleanJob.Name = job.Name
+		cleanJob.CronExpression = job.CronExpression
+		cleanJob.Timezone = job.Timezone
+		cleanJob.Channel = job.Channel
+		cleanJob.Title = job.Title
+		cleanJob.Description = job.Description
+		cleanJob.Content = job.Content
+		cleanJob.URL = job.URL
+		cleanJob.To = job.To
+		cleanJob.RenderMode = job.RenderMode
+		err = validateScheduledJob(&cleanJob)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	// Runs missed while the job was disabled are skipped.
+	cleanJob.NextRunTime, _ = getJobNextRunTime(&cleanJob, time.Now())
+	err = cleanJob.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanJob,
+	})
+	return
+}
+
+// RunScheduledJob 立即运行一次任务，不影响下一次运行时间
+func RunScheduledJob(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt("id")
+	job, err := model.GetScheduledJobById(id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	run := runScheduledJob(job, common.GetTimestamp())
+	c.JSON(http.StatusOK, gin.H{
+		"success": run.Error == "",
+		"message": run.Error,
+		"data":    run,
+	})
+	return
+}
+
+// runScheduledJob 根据任务的消息模板推送一条消息，并记录运行结果
+func runScheduledJob(job *model.ScheduledJob, scheduledTime int64) *model.ScheduledJobRun {
+	run := &model.ScheduledJobRun{
+		JobId:         job.Id,
+		ScheduledTime: scheduledTime,
+		StartedTime:   common.GetTimestamp(),
+		Status:        common.MessageSendStatusFailed,
+	}
+	err := sendScheduledJobMessage(job, run)
+	if err == nil {
+		run.Status = common.MessageSendStatusSent
+	} else {
+		run.Error = err.Error()
+		if channel.IsPartialSendError(err) {
+			run.Status = common.MessageSendStatusPartiallySent
+		}
+	}
+	err = run.Insert()
+	if err != nil {
+		common.SysError("failed to record scheduled job run: " + err.Error())
+	}
+	err = job.UpdateLastStatus(run.Status)
+	if err != nil {
+		common.SysError("failed to update scheduled job status: " + err.Error())
+	}
+	return run
+}
+
+func sendScheduledJobMessage(job *model.ScheduledJob, run *model.ScheduledJobRun) error {
+	user, err := model.GetUserById(job.UserId, false)
+	if err != nil {
+		return err
+	}
+	if user.Status != common.UserStatusEnabled {
+		return errors.New("用户已被封禁")
+	}
+	message := &model.Message{
+		Title:       job.Title,
+		Description: job.Description,
+		Content:     job.Content,
+		URL:         job.URL,
+		Channel:     job.Channel,
+		To:          job.To,
+		RenderMode:  job.RenderMode,
+	}
+	err = sendMessage(message, user)
+	run.MessageLink = message.Link
+	return err
+}
+
+// InitScheduledJobScheduler starts polling the database for due jobs.
+// Every run is claimed in the database first, so replicas sharing the database won't run a job twice.
+func InitScheduledJobScheduler() {
+	go func() {
+		for {
+			runDueScheduledJobs()
+			time.Sleep(ScheduledJobSchedulerInterval)
+		}
+	}()
+}
+
+func runDueScheduledJobs() {
+	now := time.Now()
+	jobs, err := model.GetDueScheduledJobs(now.Unix())
+	if err != nil {
+		common.SysError("failed to load scheduled jobs: " + err.Error())
+		return
+	}
+	for _, job := range jobs {
+		scheduledTime := job.NextRunTime
+		// Runs missed while the server was down are merged into this one.
+		nextRunTime, err := getJobNextRunTime(job, now)
+		if err != nil {
+			common.SysError("invalid scheduled job " + strconv.Itoa(job.Id) + ": " + err.Error())
+			nextRunTime = 0
+		}
+		claimed, err := model.ClaimScheduledJob(job, nextRunTime, now.Unix())
+		if err != nil {
+			common.SysError("failed to claim scheduled job: " + err.Error())
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		go runScheduledJob(job, scheduledTime)
+	}
+}
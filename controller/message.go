@@ -39,6 +39,24 @@ func parseArticles(articlesStr string) []model.Article {
     return articles 
 } 
 
+// parseSendAt 解析 Unix 时间戳（秒），无效时返回 0，即立即发送
+func parseSendAt(sendAtStr string) int64 {
+	sendAt, _ := strconv.ParseInt(sendAtStr, 10, 64)
+	return sendAt
+}
+
+// parsePriority 解析消息优先级，无效时返回 -1，以便后续校验时报错
+func parsePriority(priorityStr string) int {
+	if priorityStr == "" {
+		return common.MessagePriorityUnset
+	}
+	priority, err := strconv.Atoi(priorityStr)
+	if err != nil {
+		return -1
+	}
+	return priority
+}
+
 // GetPushMessage 处理 GET 请求，从查询参数中获取消息信息并推送消息
 func GetPushMessage(c *gin.Context) { 
     message := model.Message{ 
@@ -55,7 +73,13 @@ func GetPushMessage(c *gin.Context) {
         OpenId:      c.Query("openid"),
         Async:       c.Query("async") == "true",
         RenderMode:  c.Query("render_mode"),
+        Priority:    parsePriority(c.Query("priority")),
         Articles:    parseArticles(c.Query("articles")), 
+        SendAt:      parseSendAt(c.Query("send_at")),
+        Delay:       c.Query("delay"),
+        IdempotencyKey: c.Query("idempotency_key"),
+        DedupKey:    c.Query("dedup_key"),
+        Event:       c.Query("event"),
     } 
     keepCompatible(&message) 
     pushMessageHelper(c, &message) 
@@ -90,7 +114,13 @@ func PostPushMessage(c *gin.Context) {
             OpenId:      c.PostForm("openid"),
             Async:       c.PostForm("async") == "true",
             RenderMode:  c.PostForm("render_mode"),
+            Priority:    parsePriority(c.PostForm("priority")),
             Articles:    parseArticles(c.PostForm("articles")), 
+            SendAt:      parseSendAt(c.PostForm("send_at")),
+            Delay:       c.PostForm("delay"),
+            IdempotencyKey: c.PostForm("idempotency_key"),
+            DedupKey:    c.PostForm("dedup_key"),
+            Event:       c.PostForm("event"),
         } 
     }
 	// 修改比较逻辑，检查关键字段是否为空
@@ -135,6 +165,12 @@ func pushMessageHelper(c *gin.Context, message *model.Message) {
 	if message.Token == "" {
 		message.Token = strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
 	}
+	if message.IdempotencyKey == "" {
+		message.IdempotencyKey = c.Request.Header.Get("Idempotency-Key")
+	}
+	if c.Query("dry_run") == "true" {
+		message.DryRun = true
+	}
 	processMessage(c, message, &user, true)
 }
 
@@ -152,7 +188,8 @@ func authMessage(messageToken string, userToken string, channelToken *string) bo
 	return true
 }
 
-func processMessage(c *gin.Context, message *model.Message, user *model.User, needAuth bool) {
+// prepareMessage 填充消息的默认标题与默认通道，并处理渲染模式
+func prepareMessage(message *model.Message, user *model.User) {
 	if message.Title == "" {
 		message.Title = common.SystemName
 	}
@@ -162,46 +199,249 @@ func processMessage(c *gin.Context, message *model.Message, user *model.User, ne
 			message.Channel = model.TypeEmail
 		}
 	}
+	if message.RenderMode == "code" {
+		if message.Content != "" {
+			message.Content = fmt.Sprintf("```\n%s\n```", message.Content)
+		}
+	}
+}
+
+// processMessage 推送消息并响应请求，返回发送失败或请求被拒绝的原因
+func processMessage(c *gin.Context, message *model.Message, user *model.User, needAuth bool) error {
+	prepareMessage(message, user)
 	channel_, err := model.GetChannelByName(message.Channel, user.Id)
 	if err != nil {
+		err = errors.New("无效的渠道名称：" + message.Channel)
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "无效的渠道名称：" + message.Channel,
+			"message": err.Error(),
 		})
-		return
+		return err
 	}
-	if needAuth && !authMessage(message.Token, user.Token, channel_.Token) {
-		if message.Token == "" {
+	usingApiToken := false
+	if needAuth {
+		usingApiToken, err = authApiToken(c, message, user, channel_)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"success": false,
-				"message": "通道维度或用户维度设置了鉴权令牌，需要提供鉴权令牌",
+				"message": err.Error(),
 			})
-			return
+			return err
+		}
+	}
+	if needAuth && !usingApiToken && !authMessage(message.Token, user.Token, channel_.Token) {
+		err = errors.New("无效的 token")
+		if message.Token == "" {
+			err = errors.New("通道维度或用户维度设置了鉴权令牌，需要提供鉴权令牌")
 		}
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
-			"message": "无效的 token",
+			"message": err.Error(),
 		})
-		return
+		return err
 	}
-	if message.RenderMode == "code" {
-		if message.Content != "" {
-			message.Content = fmt.Sprintf("```\n%s\n```", message.Content)
+	err = validateAlertEvent(message)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return err
+	}
+	if message.Priority < common.MessagePriorityUnset || message.Priority > common.MessagePriorityUrgent {
+		err = errors.New("无效的消息优先级，取值范围为 1-5")
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return err
+	}
+	if message.DryRun {
+		return previewMessage(c, message, user, channel_)
+	}
+	if message.IdempotencyKey != "" {
+		if len(message.IdempotencyKey) > 64 {
+			err = errors.New("幂等键长度不能超过 64 个字符")
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return err
+		}
+		existing, err := model.ReserveIdempotencyKey(user.Id, message.IdempotencyKey)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return err
+		}
+		if existing != nil {
+			respondIdempotentMessage(c, existing)
+			return nil
+		}
+	}
+	var alert *model.Alert
+	if message.DedupKey != "" {
+		var suppressed bool
+		alert, suppressed, err = applyAlertEvent(message, user)
+		if err != nil {
+			if message.IdempotencyKey != "" {
+				_ = model.ReleaseIdempotencyKey(user.Id, message.IdempotencyKey)
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return err
+		}
+		if suppressed {
+			respondSuppressedAlert(c, message, user, alert)
+			return nil
 		}
 	}
 	err = saveAndSendMessage(user, message, channel_)
+	if message.IdempotencyKey != "" {
+		completeIdempotencyKey(message, user, err)
+	}
+	if alert != nil {
+		completeAlertEvent(message, alert, err)
+	}
 	if err != nil {
+		if channel.IsPartialSendError(err) {
+			// The message has been delivered to some targets, the caller shouldn't push it again.
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"message": err.Error(),
+				"uuid":    message.Link,
+				"status":  common.MessageSendStatusPartiallySent,
+			})
+			return err
+		}
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": err.Error(),
 		})
-		return
+		return err
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
 		"uuid":    message.Link,
 	})
+	return nil
+}
+
+// previewMessage 返回通道将要发送的请求内容，消息不会被发送或保存，幂等键与告警去重也不会生效
+func previewMessage(c *gin.Context, message *model.Message, user *model.User, channel_ *model.Channel) error {
+	var payload *channel.Payload
+	err := parseMessageDelay(message)
+	if err == nil && channel_.Status != common.ChannelStatusEnabled {
+		err = errors.New("该渠道已被禁用")
+	}
+	if err == nil {
+		message.Token = ""
+		message.Link = "dry-run"
+		if message.URL == "" {
+			message.URL = fmt.Sprintf("%s/message/%s", common.ServerAddress, message.Link)
+		}
+		payload, err = channel.PreviewMessage(message, user, channel_)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return err
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"channel": channel_.Name,
+			"type":    channel_.Type,
+			"message": message,
+			"payload": payload,
+		},
+	})
+	return nil
+}
+
+// respondIdempotentMessage 返回与本次请求幂等键相同的首次请求的结果
+func respondIdempotentMessage(c *gin.Context, existing *model.IdempotencyKey) {
+	if existing.Link == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "使用相同幂等键的请求正在处理中，请稍后重试",
+		})
+		return
+	}
+	status := existing.GetLatestStatus()
+	errorMessage := ""
+	if status == common.MessageSendStatusFailed {
+		errorMessage = "使用相同幂等键的消息发送失败"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":   status != common.MessageSendStatusFailed,
+		"message":   errorMessage,
+		"uuid":      existing.Link,
+		"status":    status,
+		"duplicate": true,
+	})
+}
+
+// completeIdempotencyKey 记录幂等键对应的消息，如果消息未被创建则释放幂等键，以便调用方修正请求后重试
+func completeIdempotencyKey(message *model.Message, user *model.User, sendErr error) {
+	var err error
+	if message.Id == 0 && message.Link != "unsaved" {
+		err = model.ReleaseIdempotencyKey(user.Id, message.IdempotencyKey)
+	} else {
+		status := common.MessageSendStatusSent
+		if sendErr != nil {
+			status = common.MessageSendStatusFailed
+			if channel.IsPartialSendError(sendErr) {
+				status = common.MessageSendStatusPartiallySent
+			}
+		} else if message.SendAt > common.GetTimestamp() {
+			status = common.MessageSendStatusScheduled
+		} else if message.Async {
+			status = common.MessageSendStatusAsyncPending
+		}
+		err = model.CompleteIdempotencyKey(user.Id, message.IdempotencyKey, message.Link, status)
+	}
+	if err != nil {
+		common.SysError("failed to save idempotency key: " + err.Error())
+	}
+}
+
+// sendMessage 通过用户的通道发送消息，供定时任务等不需要鉴权的内部调用使用
+func sendMessage(message *model.Message, user *model.User) error {
+	prepareMessage(message, user)
+	channel_, err := model.GetChannelByName(message.Channel, user.Id)
+	if err != nil {
+		return errors.New("无效的渠道名称：" + message.Channel)
+	}
+	return saveAndSendMessage(user, message, channel_)
+}
+
+// parseMessageDelay 将相对的发送延迟（例如 30m 或秒数）转换为 SendAt
+func parseMessageDelay(message *model.Message) error {
+	if message.Delay == "" {
+		return nil
+	}
+	delay, err := time.ParseDuration(message.Delay)
+	if err != nil {
+		seconds, err := strconv.ParseInt(message.Delay, 10, 64)
+		if err != nil {
+			return errors.New("无效的延迟发送时间：" + message.Delay)
+		}
+		delay = time.Duration(seconds) * time.Second
+	}
+	if delay < 0 {
+		return errors.New("延迟发送时间不能为负数")
+	}
+	message.SendAt = time.Now().Add(delay).Unix()
+	return nil
 }
 
 // saveAndSendMessage 保存消息并发送消息，根据配置决定是否持久化消息，同时处理消息同步和发送逻辑
@@ -209,32 +449,45 @@ func saveAndSendMessage(user *model.User, message *model.Message, channel_ *mode
     if channel_.Status != common.ChannelStatusEnabled { 
         return errors.New("该渠道已被禁用") 
     } 
+    err := parseMessageDelay(message)
+    if err != nil {
+        return err
+    }
+    scheduled := message.SendAt > common.GetTimestamp()
     common.MessageCount += 1 // We don't need to use atomic here because it's not a critical value 
     message.Link = common.GetUUID() 
     if message.URL == "" { 
         message.URL = fmt.Sprintf("%s/message/%s", common.ServerAddress, message.Link) 
     } 
     success := false 
+    partial := false
     if common.MessagePersistenceEnabled || user.SaveMessageToDatabase == common.SaveMessageToDatabaseAllowed { 
         defer func() { 
             // Update the status of the message 
             status := common.MessageSendStatusFailed 
-            if message.Async { 
+            if scheduled {
+                status = common.MessageSendStatusScheduled
+            } else if message.Async {
                 status = common.MessageSendStatusAsyncPending 
             } else { 
                 if success { 
                     status = common.MessageSendStatusSent 
+                } else if partial {
+                    status = common.MessageSendStatusPartiallySent
                 } 
             } 
             err := message.UpdateStatus(status) 
             if err != nil { 
                 common.SysError("failed to update the status of the message: " + err.Error()) 
             } 
-            if message.Async { 
-                channel.AsyncMessageQueue <- message.Id 
+            if message.Async && !scheduled {
+                err = channel.EnqueueAsyncMessage(message.Id)
+                if err != nil {
+                    common.SysError("failed to enqueue the async message: " + err.Error())
+                }
             } 
         }() 
-        err := message.UpdateAndInsert(user.Id) 
+        err = message.UpdateAndInsert(user.Id)
         if err != nil { 
             common.SysError("保存消息失败: " + err.Error()) 
             return err 
@@ -247,16 +500,20 @@ func saveAndSendMessage(user *model.User, message *model.Message, channel_ *mode
         if message.Async { 
             return errors.New("异步发送消息需要用户具备消息持久化的权限") 
         } 
+        if scheduled {
+            return errors.New("定时发送消息需要用户具备消息持久化的权限")
+        }
         message.Link = "unsaved" // This is for user to identify whether the message is saved 
         // 修正：使用匿名函数包裹调用并添加错误处理 
         go func() { 
             syncMessageToUser(message, user.Id)
         }() 
     } 
-    if !message.Async { 
-        err := channel.SendMessage(message, user, channel_) 
+    if !message.Async && !scheduled {
+        err = channel.SendMessageWithRetry(message, user, channel_)
         if err != nil { 
             common.SysError("发送消息失败: " + err.Error()) // 添加错误日志 
+            partial = channel.IsPartialSendError(err)
             return err 
         } 
     } 
@@ -350,10 +607,28 @@ func GetMessage(c *gin.Context) {
 		})
 		return
 	}
+	attempts, err := model.GetMessageAttemptsByMessageId(message.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	deliveries, err := model.GetMessageDeliveriesByMessageId(message.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "",
-		"data":    message,
+		"success":    true,
+		"message":    "",
+		"data":       message,
+		"attempts":   attempts,
+		"deliveries": deliveries,
 	})
 	return
 }
@@ -399,10 +674,11 @@ func ResendMessage(c *gin.Context) {
 	userId := c.GetInt("id")
 	helper := func() error {
 		message, err := model.GetMessageByIds(messageId, userId)
-		message.Id = 0
 		if err != nil {
 			return err
 		}
+		message.Id = 0
+		message.SendAt = 0
 		user, err := model.GetUserById(userId, true)
 		if err != nil {
 			return err
@@ -432,6 +708,86 @@ func ResendMessage(c *gin.Context) {
 	return
 }
 
+func GetScheduledMessages(c *gin.Context) {
+	userId := c.GetInt("id")
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	messages, err := model.GetScheduledMessagesByUserId(userId, p*common.ItemsPerPage, common.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    messages,
+	})
+	return
+}
+
+type RescheduleRequest struct {
+	SendAt int64  `json:"send_at"`
+	Delay  string `json:"delay"`
+}
+
+func RescheduleMessage(c *gin.Context) {
+	messageId, _ := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt("id")
+	var req RescheduleRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	message := model.Message{SendAt: req.SendAt, Delay: req.Delay}
+	err = parseMessageDelay(&message)
+	if err == nil && message.SendAt <= common.GetTimestamp() {
+		err = errors.New("定时发送时间必须晚于当前时间")
+	}
+	if err == nil {
+		err = model.RescheduleMessage(messageId, userId, message.SendAt)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"send_at": message.SendAt,
+	})
+	return
+}
+
+func CancelScheduledMessage(c *gin.Context) {
+	messageId, _ := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt("id")
+	err := model.CancelScheduledMessage(messageId, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
 func DeleteMessage(c *gin.Context) {
 	messageId, _ := strconv.Atoi(c.Param("id"))
 	userId := c.GetInt("id")
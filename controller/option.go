@@ -3,8 +3,10 @@ package controller
 import (
 	"encoding/json"
 	"github.com/gin-gonic/gin"
+	"message-pusher/channel"
 	"message-pusher/common"
 	"message-pusher/model"
+	"net"
 	"net/http"
 	"strings"
 )
@@ -57,6 +59,28 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "OutboundAllowlist":
+		for _, entry := range common.ParseOutboundAllowlist(option.Value) {
+			_, _, err := net.ParseCIDR(entry)
+			if err != nil && net.ParseIP(entry) == nil && common.Validate.Var(entry, "hostname_rfc1123") != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "无效的内网访问白名单条目：" + entry,
+				})
+				return
+			}
+		}
+	case "OutboundProxy":
+		if option.Value != "" {
+			_, err = channel.ParseProxyURL(option.Value)
+			if err != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": err.Error(),
+				})
+				return
+			}
+		}
 	case "TurnstileCheckEnabled":
 		if option.Value == "true" && common.TurnstileSiteKey == "" {
 			c.JSON(http.StatusOK, gin.H{
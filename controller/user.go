@@ -258,15 +258,8 @@ func GenerateToken(c *gin.Context) {
 	}
 	user.Token = uuid.New().String()
 	user.Token = strings.Replace(user.Token, "-", "", -1)
-
-	if model.DB.Where("token = ?", user.Token).First(user).RowsAffected != 0 {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "请重试，系统生成的 UUID 竟然重复了！",
-		})
-		return
-	}
-
+	// Tokens are only compared with the user's own, so they don't need to be unique.
+	// They can't be looked up either since they are encrypted with random nonces.
 	if err := user.Update(false); err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"message-pusher/common"
+	"message-pusher/model"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const webhookRequestBodyLimit = 64 * 1024
+
+// Values of these headers are credentials, they are not stored.
+var webhookRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Gitlab-Token"}
+
+// recordWebhookRequest 在 Webhook 开启请求记录时保存请求内容与处理结果
+func recordWebhookRequest(webhook *model.Webhook, record *model.WebhookRequest, header http.Header, rawQuery string, reqText string) {
+	if webhook.LogLimit <= 0 {
+		return
+	}
+	record.WebhookId = webhook.Id
+	record.Headers = make(map[string]string, len(header))
+	for key := range header {
+		record.Headers[key] = header.Get(key)
+	}
+	for _, key := range webhookRedactedHeaders {
+		if _, ok := record.Headers[key]; ok {
+			record.Headers[key] = "******"
+		}
+	}
+	record.Query = rawQuery
+	record.Body = reqText
+	if len(record.Body) > webhookRequestBodyLimit {
+		record.Body = record.Body[:webhookRequestBodyLimit]
+		record.Truncated = true
+	}
+	record.CreatedTime = common.GetTimestamp()
+	err := record.Insert(webhook.LogLimit)
+	if err != nil {
+		common.SysError("failed to record webhook request: " + err.Error())
+	}
+}
+
+func GetWebhookRequests(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt("id")
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	_, err := model.GetWebhookById(id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	requests, err := model.GetWebhookRequestsByWebhookId(id, p*common.ItemsPerPage, common.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    requests,
+	})
+	return
+}
+
+// ReplayWebhookRequest 使用 Webhook 当前的规则重新处理一条记录的请求，重放时不校验签名
+func ReplayWebhookRequest(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	requestId, _ := strconv.Atoi(c.Param("request_id"))
+	userId := c.GetInt("id")
+	webhook, err := model.GetWebhookById(id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	request, err := model.GetWebhookRequestById(requestId, webhook.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if request.Truncated {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该请求的请求体过大，未被完整记录，无法重放",
+		})
+		return
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	header := make(http.Header, len(request.Headers))
+	for key, value := range request.Headers {
+		header.Set(key, value)
+	}
+	query, _ := url.ParseQuery(request.Query)
+	var record *model.WebhookRequest
+	if request.Endpoint == model.WebhookEndpointAlertmanager {
+		record = executeAlertmanagerWebhook(c, webhook, user, request.Body, query)
+	} else {
+		record = executeWebhook(c, webhook, user, request.Body, header, query)
+	}
+	record.ReplayOf = request.Id
+	recordWebhookRequest(webhook, record, header, request.Query, request.Body)
+}
@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"message-pusher/common"
+	"message-pusher/model"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var webhookVerifySchemes = []string{
+	common.WebhookVerifySchemeNone,
+	common.WebhookVerifySchemeGitHub,
+	common.WebhookVerifySchemeGitLab,
+	common.WebhookVerifySchemeStripe,
+	common.WebhookVerifySchemeHMAC,
+	common.WebhookVerifySchemeBearer,
+}
+
+const defaultWebhookSignatureHeader = "X-Signature"
+const defaultWebhookTimestampHeader = "X-Timestamp"
+const defaultWebhookTolerance = 5 * 60
+
+func validateWebhookVerifyScheme(webhook *model.Webhook) error {
+	valid := false
+	for _, scheme := range webhookVerifySchemes {
+		if webhook.VerifyScheme == scheme {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return errors.New("不支持的签名校验方式：" + webhook.VerifyScheme)
+	}
+	if webhook.VerifyScheme != common.WebhookVerifySchemeNone && webhook.Secret == "" {
+		return errors.New("启用签名校验时密钥不能为空")
+	}
+	if webhook.Tolerance < 0 {
+		return errors.New("时间戳容差不能为负数")
+	}
+	return nil
+}
+
+func computeHMACSHA256(secret string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// checkSignature accepts hex or base64 encoded signatures, with or without the sha256= prefix.
+func checkSignature(signature string, expected []byte) bool {
+	signature = strings.TrimPrefix(strings.TrimSpace(signature), "sha256=")
+	if decoded, err := hex.DecodeString(signature); err == nil && hmac.Equal(decoded, expected) {
+		return true
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(signature); err == nil && hmac.Equal(decoded, expected) {
+		return true
+	}
+	return false
+}
+
+func checkTimestamp(timestamp string, tolerance int) error {
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("无效的时间戳：" + timestamp)
+	}
+	if tolerance == 0 {
+		tolerance = defaultWebhookTolerance
+	}
+	diff := common.GetTimestamp() - t
+	if diff > int64(tolerance) || diff < -int64(tolerance) {
+		return fmt.Errorf("时间戳超出 %d 秒的容差范围，请求可能被重放", tolerance)
+	}
+	return nil
+}
+
+// verifyWebhookRequest 按照 Webhook 配置的方式校验请求签名
+func verifyWebhookRequest(webhook *model.Webhook, header http.Header, body []byte) error {
+	switch webhook.VerifyScheme {
+	case common.WebhookVerifySchemeNone:
+		return nil
+	case common.WebhookVerifySchemeGitHub:
+		// https://docs.github.com/en/webhooks/using-webhooks/validating-webhook-deliveries
+		signature := header.Get("X-Hub-Signature-256")
+		if !strings.HasPrefix(signature, "sha256=") {
+			return errors.New("缺少 X-Hub-Signature-256 请求头")
+		}
+		if !checkSignature(signature, computeHMACSHA256(webhook.Secret, body)) {
+			return errors.New("签名校验失败")
+		}
+	case common.WebhookVerifySchemeGitLab:
+		token := header.Get("X-Gitlab-Token")
+		if token == "" {
+			return errors.New("缺少 X-Gitlab-Token 请求头")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(webhook.Secret)) != 1 {
+			return errors.New("令牌校验失败")
+		}
+	case common.WebhookVerifySchemeStripe:
+		// https://docs.stripe.com/webhooks#verify-manually
+		timestamp := ""
+		var signatures []string
+		for _, item := range strings.Split(header.Get("Stripe-Signature"), ",") {
+			parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			switch parts[0] {
+			case "t":
+				timestamp = parts[1]
+			case "v1":
+				signatures = append(signatures, parts[1])
+			}
+		}
+		if timestamp == "" || len(signatures) == 0 {
+			return errors.New("缺少或无效的 Stripe-Signature 请求头")
+		}
+		expected := computeHMACSHA256(webhook.Secret, []byte(timestamp+"."+string(body)))
+		verified := false
+		for _, signature := range signatures {
+			if checkSignature(signature, expected) {
+				verified = true
+				break
+			}
+		}
+		if !verified {
+			return errors.New("签名校验失败")
+		}
+		return checkTimestamp(timestamp, webhook.Tolerance)
+	case common.WebhookVerifySchemeHMAC:
+		signatureHeader := webhook.SignatureHeader
+		if signatureHeader == "" {
+			signatureHeader = defaultWebhookSignatureHeader
+		}
+		signature := header.Get(signatureHeader)
+		if signature == "" {
+			return errors.New("缺少 " + signatureHeader + " 请求头")
+		}
+		// If the sender provides a timestamp, it's signed along with the body to prevent replays.
+		timestamp := header.Get(defaultWebhookTimestampHeader)
+		payload := body
+		if timestamp != "" {
+			payload = []byte(timestamp + "." + string(body))
+		}
+		if !checkSignature(signature, computeHMACSHA256(webhook.Secret, payload)) {
+			return errors.New("签名校验失败")
+		}
+		if timestamp != "" {
+			return checkTimestamp(timestamp, webhook.Tolerance)
+		}
+	case common.WebhookVerifySchemeBearer:
+		parts := strings.SplitN(header.Get("Authorization"), " ", 2)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+			return errors.New("缺少 Authorization: Bearer 请求头")
+		}
+		if subtle.ConstantTimeCompare([]byte(parts[1]), []byte(webhook.Secret)) != 1 {
+			return errors.New("令牌校验失败")
+		}
+	default:
+		return errors.New("不支持的签名校验方式：" + webhook.VerifyScheme)
+	}
+	return nil
+}
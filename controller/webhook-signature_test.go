@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"message-pusher/common"
+	"message-pusher/model"
+	"net/http"
+	"testing"
+)
+
+func TestVerifyWebhookRequest(t *testing.T) {
+	const secret = "s3cr3t"
+	body := []byte(`{"action":"opened"}`)
+	tampered := []byte(`{"action":"closed"}`)
+	now := common.GetTimestamp()
+	sign := func(payload string) string {
+		return hex.EncodeToString(computeHMACSHA256(secret, []byte(payload)))
+	}
+	stripeHeader := func(timestamp int64, payload []byte) string {
+		return fmt.Sprintf("t=%d,v1=%s", timestamp, sign(fmt.Sprintf("%d.%s", timestamp, payload)))
+	}
+	tests := []struct {
+		name    string
+		webhook model.Webhook
+		header  map[string]string
+		body    []byte
+		valid   bool
+	}{
+		{"none", model.Webhook{VerifyScheme: common.WebhookVerifySchemeNone}, nil, body, true},
+
+		{"github valid", model.Webhook{VerifyScheme: common.WebhookVerifySchemeGitHub, Secret: secret},
+			map[string]string{"X-Hub-Signature-256": "sha256=" + sign(string(body))}, body, true},
+		{"github tampered", model.Webhook{VerifyScheme: common.WebhookVerifySchemeGitHub, Secret: secret},
+			map[string]string{"X-Hub-Signature-256": "sha256=" + sign(string(body))}, tampered, false},
+		{"github wrong secret", model.Webhook{VerifyScheme: common.WebhookVerifySchemeGitHub, Secret: "other"},
+			map[string]string{"X-Hub-Signature-256": "sha256=" + sign(string(body))}, body, false},
+		{"github without prefix", model.Webhook{VerifyScheme: common.WebhookVerifySchemeGitHub, Secret: secret},
+			map[string]string{"X-Hub-Signature-256": sign(string(body))}, body, false},
+		{"github missing", model.Webhook{VerifyScheme: common.WebhookVerifySchemeGitHub, Secret: secret},
+			nil, body, false},
+
+		{"gitlab valid", model.Webhook{VerifyScheme: common.WebhookVerifySchemeGitLab, Secret: secret},
+			map[string]string{"X-Gitlab-Token": secret}, body, true},
+		{"gitlab wrong token", model.Webhook{VerifyScheme: common.WebhookVerifySchemeGitLab, Secret: secret},
+			map[string]string{"X-Gitlab-Token": secret + "x"}, body, false},
+		{"gitlab missing", model.Webhook{VerifyScheme: common.WebhookVerifySchemeGitLab, Secret: secret},
+			nil, body, false},
+
+		{"stripe valid", model.Webhook{VerifyScheme: common.WebhookVerifySchemeStripe, Secret: secret},
+			map[string]string{"Stripe-Signature": stripeHeader(now, body)}, body, true},
+		{"stripe rotated secret", model.Webhook{VerifyScheme: common.WebhookVerifySchemeStripe, Secret: secret},
+			map[string]string{"Stripe-Signature": stripeHeader(now, body) + ",v1=" + sign("other")}, body, true},
+		{"stripe tampered", model.Webhook{VerifyScheme: common.WebhookVerifySchemeStripe, Secret: secret},
+			map[string]string{"Stripe-Signature": stripeHeader(now, body)}, tampered, false},
+		{"stripe tampered timestamp", model.Webhook{VerifyScheme: common.WebhookVerifySchemeStripe, Secret: secret},
+			map[string]string{"Stripe-Signature": fmt.Sprintf("t=%d,v1=%s", now+1, sign(fmt.Sprintf("%d.%s", now, body)))}, body, false},
+		{"stripe expired", model.Webhook{VerifyScheme: common.WebhookVerifySchemeStripe, Secret: secret},
+			map[string]string{"Stripe-Signature": stripeHeader(now-defaultWebhookTolerance-10, body)}, body, false},
+		{"stripe future", model.Webhook{VerifyScheme: common.WebhookVerifySchemeStripe, Secret: secret},
+			map[string]string{"Stripe-Signature": stripeHeader(now+defaultWebhookTolerance+10, body)}, body, false},
+		{"stripe within custom tolerance", model.Webhook{VerifyScheme: common.WebhookVerifySchemeStripe, Secret: secret, Tolerance: 3600},
+			map[string]string{"Stripe-Signature": stripeHeader(now-1800, body)}, body, true},
+		{"stripe missing timestamp", model.Webhook{VerifyScheme: common.WebhookVerifySchemeStripe, Secret: secret},
+			map[string]string{"Stripe-Signature": "v1=" + sign(string(body))}, body, false},
+
+		{"hmac valid", model.Webhook{VerifyScheme: common.WebhookVerifySchemeHMAC, Secret: secret},
+			map[string]string{"X-Signature": sign(string(body))}, body, true},
+		{"hmac base64", model.Webhook{VerifyScheme: common.WebhookVerifySchemeHMAC, Secret: secret},
+			map[string]string{"X-Signature": base64.StdEncoding.EncodeToString(computeHMACSHA256(secret, body))}, body, true},
+		{"hmac custom header", model.Webhook{VerifyScheme: common.WebhookVerifySchemeHMAC, Secret: secret, SignatureHeader: "X-My-Signature"},
+			map[string]string{"X-My-Signature": "sha256=" + sign(string(body))}, body, true},
+		{"hmac tampered", model.Webhook{VerifyScheme: common.WebhookVerifySchemeHMAC, Secret: secret},
+			map[string]string{"X-Signature": sign(string(body))}, tampered, false},
+		{"hmac missing", model.Webhook{VerifyScheme: common.WebhookVerifySchemeHMAC, Secret: secret},
+			nil, body, false},
+		{"hmac with timestamp", model.Webhook{VerifyScheme: common.WebhookVerifySchemeHMAC, Secret: secret},
+			map[string]string{"X-Signature": sign(fmt.Sprintf("%d.%s", now, body)), "X-Timestamp": fmt.Sprint(now)}, body, true},
+		{"hmac timestamp not signed", model.Webhook{VerifyScheme: common.WebhookVerifySchemeHMAC, Secret: secret},
+			map[string]string{"X-Signature": sign(string(body)), "X-Timestamp": fmt.Sprint(now)}, body, false},
+		{"hmac expired", model.Webhook{VerifyScheme: common.WebhookVerifySchemeHMAC, Secret: secret},
+			map[string]string{"X-Signature": sign(fmt.Sprintf("%d.%s", now-3600, body)), "X-Timestamp": fmt.Sprint(now - 3600)}, body, false},
+		{"hmac invalid timestamp", model.Webhook{VerifyScheme: common.WebhookVerifySchemeHMAC, Secret: secret},
+			map[string]string{"X-Signature": sign("abc." + string(body)), "X-Timestamp": "abc"}, body, false},
+
+		{"bearer valid", model.Webhook{VerifyScheme: common.WebhookVerifySchemeBearer, Secret: secret},
+			map[string]string{"Authorization": "Bearer " + secret}, body, true},
+		{"bearer lower case scheme", model.Webhook{VerifyScheme: common.WebhookVerifySchemeBearer, Secret: secret},
+			map[string]string{"Authorization": "bearer " + secret}, body, true},
+		{"bearer bare secret", model.Webhook{VerifyScheme: common.WebhookVerifySchemeBearer, Secret: secret},
+			map[string]string{"Authorization": secret}, body, false},
+		{"bearer other scheme", model.Webhook{VerifyScheme: common.WebhookVerifySchemeBearer, Secret: secret},
+			map[string]string{"Authorization": "Basic " + secret}, body, false},
+		{"bearer empty token", model.Webhook{VerifyScheme: common.WebhookVerifySchemeBearer, Secret: secret},
+			map[string]string{"Authorization": "Bearer "}, body, false},
+		{"bearer wrong token", model.Webhook{VerifyScheme: common.WebhookVerifySchemeBearer, Secret: secret},
+			map[string]string{"Authorization": "Bearer " + secret[1:]}, body, false},
+		{"bearer missing", model.Webhook{VerifyScheme: common.WebhookVerifySchemeBearer, Secret: secret},
+			nil, body, false},
+
+		{"unknown scheme", model.Webhook{VerifyScheme: "unknown", Secret: secret}, nil, body, false},
+	}
+	for _, test := range tests {
+		header := http.Header{}
+		for key, value := range test.header {
+			header.Set(key, value)
+		}
+		err := verifyWebhookRequest(&test.webhook, header, test.body)
+		if test.valid && err != nil {
+			t.Errorf("%s: verifyWebhookRequest failed: %v", test.name, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%s: verifyWebhookRequest should fail", test.name)
+		}
+	}
+}
+
+func TestValidateWebhookVerifyScheme(t *testing.T) {
+	tests := []struct {
+		webhook model.Webhook
+		valid   bool
+	}{
+		{model.Webhook{VerifyScheme: common.WebhookVerifySchemeNone}, true},
+		{model.Webhook{VerifyScheme: common.WebhookVerifySchemeGitHub, Secret: "s"}, true},
+		{model.Webhook{VerifyScheme: common.WebhookVerifySchemeGitHub}, false},
+		{model.Webhook{VerifyScheme: common.WebhookVerifySchemeStripe, Secret: "s", Tolerance: -1}, false},
+		{model.Webhook{VerifyScheme: "unknown", Secret: "s"}, false},
+	}
+	for _, test := range tests {
+		err := validateWebhookVerifyScheme(&test.webhook)
+		if (err == nil) != test.valid {
+			t.Errorf("validateWebhookVerifyScheme(%q, secret %q, tolerance %d) = %v", test.webhook.VerifyScheme, test.webhook.Secret, test.webhook.Tolerance, err)
+		}
+	}
+}
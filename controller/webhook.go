@@ -2,12 +2,15 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/tidwall/gjson"
 	"io"
 	"message-pusher/common"
 	"message-pusher/model"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 )
@@ -74,6 +77,7 @@ func GetWebhook(c *gin.Context) {
 		})
 		return
 	}
+	webhook_.Secret = ""
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -100,14 +104,38 @@ func AddWebhook(c *gin.Context) {
 		return
 	}
 	cleanWebhook := model.Webhook{
-		UserId:        c.GetInt("id"),
-		Name:          webhook_.Name,
-		Status:        common.WebhookStatusEnabled,
-		Link:          common.GetUUID(),
-		CreatedTime:   common.GetTimestamp(),
-		Channel:       webhook_.Channel,
-		ExtractRule:   webhook_.ExtractRule,
-		ConstructRule: webhook_.ConstructRule,
+		UserId:          c.GetInt("id"),
+		Name:            webhook_.Name,
+		Status:          common.WebhookStatusEnabled,
+		Link:            common.GetUUID(),
+		CreatedTime:     common.GetTimestamp(),
+		Channel:         webhook_.Channel,
+		ExtractRule:     webhook_.ExtractRule,
+		ConstructRule:   webhook_.ConstructRule,
+		TemplateEnabled: webhook_.TemplateEnabled,
+		Filter:          webhook_.Filter,
+		Routes:          webhook_.Routes,
+		VerifyScheme:    webhook_.VerifyScheme,
+		Secret:          webhook_.Secret,
+		SignatureHeader: webhook_.SignatureHeader,
+		Tolerance:       webhook_.Tolerance,
+		LogLimit:        webhook_.LogLimit,
+		Preset:          webhook_.Preset,
+	}
+	if preset, ok := model.GetWebhookPreset(cleanWebhook.Preset); ok && cleanWebhook.VerifyScheme == "" && cleanWebhook.Secret != "" {
+		// Use the sender's signature scheme if only the secret is given
+		cleanWebhook.VerifyScheme = preset.VerifyScheme
+		if cleanWebhook.SignatureHeader == "" {
+			cleanWebhook.SignatureHeader = preset.SignatureHeader
+		}
+	}
+	err = validateWebhookRules(&cleanWebhook)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
 	}
 	err = cleanWebhook.Insert()
 	if err != nil {
@@ -171,6 +199,25 @@ func UpdateWebhook(c *gin.Context) {
 		cleanWebhook.ExtractRule = webhook_.ExtractRule
 		cleanWebhook.ConstructRule = webhook_.ConstructRule
 		cleanWebhook.Channel = webhook_.Channel
+		cleanWebhook.TemplateEnabled = webhook_.TemplateEnabled
+		cleanWebhook.Filter = webhook_.Filter
+		cleanWebhook.Routes = webhook_.Routes
+		cleanWebhook.VerifyScheme = webhook_.VerifyScheme
+		if webhook_.Secret != "" {
+			cleanWebhook.Secret = webhook_.Secret
+		}
+		cleanWebhook.SignatureHeader = webhook_.SignatureHeader
+		cleanWebhook.Tolerance = webhook_.Tolerance
+		cleanWebhook.LogLimit = webhook_.LogLimit
+		cleanWebhook.Preset = webhook_.Preset
+		err = validateWebhookRules(&cleanWebhook)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	}
 	err = cleanWebhook.Update()
 	if err != nil {
@@ -180,6 +227,7 @@ func UpdateWebhook(c *gin.Context) {
 		})
 		return
 	}
+	cleanWebhook.Secret = ""
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -188,6 +236,41 @@ func UpdateWebhook(c *gin.Context) {
 	return
 }
 
+// getTriggeredWebhook 获取被触发的 Webhook 及其所属用户，失败时已写入响应
+func getTriggeredWebhook(c *gin.Context) (*model.Webhook, *model.User, bool) {
+	webhook, err := model.GetWebhookByLink(c.Param("link"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Webhook 不存在",
+		})
+		return nil, nil, false
+	}
+	if webhook.Status != common.WebhookStatusEnabled {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "Webhook 未启用",
+		})
+		return nil, nil, false
+	}
+	user, err := model.GetUserById(webhook.UserId, false)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "用户不存在",
+		})
+		return nil, nil, false
+	}
+	if user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "用户已被封禁",
+		})
+		return nil, nil, false
+	}
+	return webhook, user, true
+}
+
 func TriggerWebhook(c *gin.Context) {
 	jsonData, err := io.ReadAll(c.Request.Body)
 	if err != nil {
@@ -198,61 +281,229 @@ func TriggerWebhook(c *gin.Context) {
 		return
 	}
 	reqText := string(jsonData)
-	link := c.Param("link")
-	webhook, err := model.GetWebhookByLink(link)
+	webhook, user, ok := getTriggeredWebhook(c)
+	if !ok {
+		return
+	}
+	err = verifyWebhookRequest(webhook, c.Request.Header, jsonData)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
+		record := &model.WebhookRequest{Error: err.Error()}
+		recordWebhookRequest(webhook, record, c.Request.Header, c.Request.URL.RawQuery, reqText)
+		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
-			"message": "Webhook 不存在",
+			"message": err.Error(),
 		})
 		return
 	}
-	if webhook.Status != common.WebhookStatusEnabled {
-		c.JSON(http.StatusForbidden, gin.H{
+	record := executeWebhook(c, webhook, user, reqText, c.Request.Header, c.Request.URL.Query())
+	recordWebhookRequest(webhook, record, c.Request.Header, c.Request.URL.RawQuery, reqText)
+}
+
+// GetWebhookPresets 返回内置的 Webhook 预设及其支持的事件
+func GetWebhookPresets(c *gin.Context) {
+	presets := make([]gin.H, 0, len(model.WebhookPresets))
+	for _, preset := range model.GetWebhookPresets() {
+		presets = append(presets, gin.H{
+			"name":             preset.Name,
+			"label":            preset.Label,
+			"event_header":     preset.EventHeader,
+			"events":           preset.EventNames(),
+			"verify_scheme":    preset.VerifyScheme,
+			"signature_header": preset.SignatureHeader,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    presets,
+	})
+	return
+}
+
+// TestWebhook 使用请求体作为示例请求，返回提取的变量与构建的消息，不会发送消息
+func TestWebhook(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt("id")
+	webhook, err := model.GetWebhookById(id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "Webhook 未启用",
+			"message": err.Error(),
 		})
 		return
 	}
-	user, err := model.GetUserById(webhook.UserId, false)
+	jsonData, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
+		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "用户不存在",
+			"message": err.Error(),
 		})
 		return
 	}
-	if user.Status != common.UserStatusEnabled {
-		c.JSON(http.StatusForbidden, gin.H{
+	reqText := string(jsonData)
+	webhook, supported := webhook.ApplyPreset(c.Request.Header)
+	if !supported {
+		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "用户已被封禁",
+			"message": "Webhook 预设不支持该事件，请检查示例请求的请求头",
 		})
 		return
 	}
-	extractRule := make(map[string]string)
-	err = json.Unmarshal([]byte(webhook.ExtractRule), &extractRule)
+	vars, err := extractWebhookVariables(webhook, reqText)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "Webhook 提取规则解析失败",
+			"message": err.Error(),
 		})
 		return
 	}
-	for key, value := range extractRule {
-		variableValue := gjson.Get(reqText, value).String()
-		webhook.ConstructRule = common.Replace(webhook.ConstructRule, "$"+key, variableValue, -1)
-	}
-	constructRule := model.WebhookConstructRule{}
-	err = json.Unmarshal([]byte(webhook.ConstructRule), &constructRule)
+	message, matched, err := buildWebhookMessage(webhook, reqText, c.Request.Header, c.Request.URL.Query(), vars)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "Webhook 构建规则解析失败",
+			"message": err.Error(),
+			"data": gin.H{
+				"variables": vars,
+			},
 		})
 		return
 	}
-	message := &model.Message{
-		Channel:     webhook.Channel,
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"variables": vars,
+			"matched":   matched,
+			"message":   message,
+		},
+	})
+	return
+}
+
+// executeWebhook 使用请求内容构建并推送消息，返回用于记录的请求处理结果
+func executeWebhook(c *gin.Context, webhook *model.Webhook, user *model.User, reqText string, header http.Header, query url.Values) *model.WebhookRequest {
+	record := &model.WebhookRequest{}
+	var message *model.Message
+	matched := false
+	resolved, supported := webhook.ApplyPreset(header)
+	var err error
+	if supported {
+		var vars map[string]string
+		vars, err = extractWebhookVariables(resolved, reqText)
+		if err == nil {
+			record.Variables = vars
+			message, matched, err = buildWebhookMessage(resolved, reqText, header, query, vars)
+		}
+	}
+	if err != nil {
+		record.Error = err.Error()
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return record
+	}
+	if !matched {
+		record.Skipped = true
+		skippedMessage := "请求不满足 Webhook 的过滤条件，已忽略"
+		if !supported {
+			skippedMessage = "Webhook 预设不支持该事件，已忽略"
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": skippedMessage,
+			"skipped": true,
+		})
+		return record
+	}
+	err = processMessage(c, message, user, false)
+	record.MessageLink = message.Link
+	if err != nil {
+		record.Error = err.Error()
+	}
+	return record
+}
+
+// extractWebhookVariables 使用 Webhook 的提取规则从请求体中提取变量
+func extractWebhookVariables(webhook *model.Webhook, reqText string) (map[string]string, error) {
+	extractRule := make(map[string]string)
+	if webhook.ExtractRule != "" || !webhook.TemplateEnabled {
+		err := json.Unmarshal([]byte(webhook.ExtractRule), &extractRule)
+		if err != nil {
+			return nil, errors.New("Webhook 提取规则解析失败")
+		}
+	}
+	vars := make(map[string]string)
+	for key, value := range extractRule {
+		vars[key] = gjson.Get(reqText, value).String()
+	}
+	return vars, nil
+}
+
+// buildWebhookMessage 根据 Webhook 的构建规则，使用请求内容与提取的变量构建消息，
+// 请求不满足过滤条件时 matched 为 false，满足路由条件时使用路由的通道
+func buildWebhookMessage(webhook *model.Webhook, reqText string, header http.Header, query url.Values, vars map[string]string) (message *model.Message, matched bool, err error) {
+	channel_, matched, err := matchWebhookRoute(webhook, vars)
+	if err != nil || !matched {
+		return nil, false, err
+	}
+	constructRule := model.WebhookConstructRule{}
+	if webhook.FieldTemplates {
+		err = json.Unmarshal([]byte(webhook.ConstructRule), &constructRule)
+		if err != nil {
+			return nil, false, errors.New("Webhook 构建规则解析失败")
+		}
+		for _, field := range []*string{&constructRule.Title, &constructRule.Description, &constructRule.Content, &constructRule.URL} {
+			*field, err = renderWebhookTemplate(*field, reqText, header, query, vars)
+			if err != nil {
+				return nil, false, errors.New("Webhook 构建规则渲染失败：" + err.Error())
+			}
+		}
+		return newWebhookMessage(channel_, &constructRule), true, nil
+	}
+	constructRuleText := webhook.ConstructRule
+	if webhook.TemplateEnabled {
+		text, err := renderWebhookTemplate(webhook.ConstructRule, reqText, header, query, vars)
+		if err != nil {
+			return nil, false, errors.New("Webhook 构建规则渲染失败：" + err.Error())
+		}
+		constructRuleText = text
+	} else {
+		for key, value := range vars {
+			constructRuleText = common.Replace(constructRuleText, "$"+key, value, -1)
+		}
+	}
+	err = json.Unmarshal([]byte(constructRuleText), &constructRule)
+	if err != nil {
+		return nil, false, errors.New("Webhook 构建规则解析失败")
+	}
+	return newWebhookMessage(channel_, &constructRule), true, nil
+}
+
+// matchWebhookRoute 使用 Webhook 的过滤条件与路由选择推送的通道，请求不满足过滤条件时 matched 为 false
+func matchWebhookRoute(webhook *model.Webhook, vars map[string]string) (channel_ string, matched bool, err error) {
+	matched, err = common.MatchFilter(webhook.Filter, vars)
+	if err != nil {
+		return "", false, errors.New("Webhook 过滤条件解析失败：" + err.Error())
+	}
+	if !matched {
+		return "", false, nil
+	}
+	for _, route := range webhook.Routes {
+		routeMatched, err := common.MatchFilter(route.Condition, vars)
+		if err != nil {
+			return "", false, errors.New("Webhook 路由条件解析失败：" + err.Error())
+		}
+		if routeMatched {
+			return route.Channel, true, nil
+		}
+	}
+	return webhook.Channel, true, nil
+}
+
+func newWebhookMessage(channel_ string, constructRule *model.WebhookConstructRule) *model.Message {
+	return &model.Message{
+		Channel:     channel_,
 		Title:       constructRule.Title,
 		Description: constructRule.Description,
 		Content:     constructRule.Content,
@@ -260,5 +511,84 @@ func TriggerWebhook(c *gin.Context) {
 		Btntxt:      constructRule.Btntxt,  // 即使为空也显式赋值
 		Articles:    constructRule.Articles, // 确保切片始终非nil
 	}
-	processMessage(c, message, user, false)
+}
+
+// renderWebhookTemplate 渲染模板形式的构建规则，模板中可以使用：
+// .body 解析后的 JSON 请求体（非 JSON 时为原始文本），.raw 原始请求体，
+// .headers 与 .query 请求头与查询参数（同名取第一个），.vars 提取规则提取的变量
+func renderWebhookTemplate(constructRule string, reqText string, header http.Header, query url.Values, vars map[string]string) (string, error) {
+	tmpl, err := common.ParseWebhookTemplate(constructRule)
+	if err != nil {
+		return "", err
+	}
+	var body interface{} = reqText
+	decoder := json.NewDecoder(strings.NewReader(reqText))
+	decoder.UseNumber()
+	var parsed interface{}
+	if decoder.Decode(&parsed) == nil {
+		body = parsed
+	}
+	headers := make(map[string]string, len(header))
+	for key := range header {
+		headers[key] = header.Get(key)
+	}
+	queries := make(map[string]string, len(query))
+	for key := range query {
+		queries[key] = query.Get(key)
+	}
+	data := map[string]interface{}{
+		"body":    body,
+		"raw":     reqText,
+		"headers": headers,
+		"query":   queries,
+		"vars":    vars,
+	}
+	var builder strings.Builder
+	err = tmpl.Execute(&builder, data)
+	return builder.String(), err
+}
+
+// validateWebhookRules 保存 Webhook 前检查规则是否合法
+func validateWebhookRules(webhook *model.Webhook) error {
+	if webhook.Preset != "" {
+		// The extract and construct rules are ignored
+		if _, ok := model.GetWebhookPreset(webhook.Preset); !ok {
+			return errors.New("不支持的 Webhook 预设：" + webhook.Preset)
+		}
+	} else {
+		if webhook.ExtractRule != "" || !webhook.TemplateEnabled {
+			extractRule := make(map[string]string)
+			err := json.Unmarshal([]byte(webhook.ExtractRule), &extractRule)
+			if err != nil {
+				return errors.New("提取规则必须是 JSON 对象，其值为 gjson 路径")
+			}
+		}
+		if webhook.TemplateEnabled {
+			_, err := common.ParseWebhookTemplate(webhook.ConstructRule)
+			if err != nil {
+				return errors.New("构建规则模板解析失败：" + err.Error())
+			}
+		}
+	}
+	_, err := common.ParseFilter(webhook.Filter)
+	if err != nil {
+		return errors.New("过滤条件解析失败：" + err.Error())
+	}
+	err = validateWebhookVerifyScheme(webhook)
+	if err != nil {
+		return err
+	}
+	if webhook.LogLimit < 0 || webhook.LogLimit > model.WebhookRequestLogMaxLimit {
+		return fmt.Errorf("请求记录数量必须在 0-%d 之间", model.WebhookRequestLogMaxLimit)
+	}
+	for i, route := range webhook.Routes {
+		if route.Channel == "" {
+			return fmt.Errorf("第 %d 条路由的通道不能为空", i+1)
+		}
+		_, err = common.ParseFilter(route.Condition)
+		if err != nil {
+			return fmt.Errorf("第 %d 条路由的条件解析失败：%s", i+1, err.Error())
+		}
+	}
+	return nil
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"embed"
+	"fmt"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-contrib/sessions/redis"
@@ -9,6 +10,7 @@ import (
 	"log"
 	"message-pusher/channel"
 	"message-pusher/common"
+	"message-pusher/controller"
 	"message-pusher/model"
 	"message-pusher/router"
 	"os"
@@ -22,23 +24,36 @@ var buildFS embed.FS
 var indexPage []byte
 
 func main() {
+	common.ParseFlags()
 	common.SetupGinLog()
 	common.SysLog("Message Pusher " + common.Version + " started")
 	if os.Getenv("GIN_MODE") != "debug" {
 		gin.SetMode(gin.ReleaseMode)
 	}
+	// Initialize secret encryption, must be done before the database
+	err := common.InitEncryptionKeys()
+	if err != nil {
+		common.FatalLog(err)
+	}
 	// Initialize SQL Database
-	err := model.InitDB()
+	err = model.InitDB()
 	if err != nil {
 		common.FatalLog(err)
 	}
-	go channel.LoadAsyncMessages()
 	defer func() {
 		err := model.CloseDB()
 		if err != nil {
 			common.FatalLog(err)
 		}
 	}()
+	if *common.RotateEncryptionKey {
+		count, err := model.RotateSecrets()
+		if err != nil {
+			common.FatalLog(err)
+		}
+		common.SysLog(fmt.Sprintf("%d secrets are re-encrypted with the current encryption key", count))
+		return
+	}
 
 	// Initialize Redis
 	err = common.InitRedisClient()
@@ -49,6 +64,15 @@ func main() {
 	// Initialize options
 	model.InitOptionMap()
 
+	// Initialize async message queue
+	channel.InitAsyncMessageQueue()
+
+	// Initialize scheduled message dispatcher
+	channel.InitMessageScheduler()
+
+	// Initialize scheduled job scheduler
+	controller.InitScheduledJobScheduler()
+
 	// Initialize token store
 	channel.TokenStoreInit()
 
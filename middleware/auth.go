@@ -1,22 +1,67 @@
 package middleware
 
 import (
+	"errors"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"message-pusher/common"
+	"message-pusher/model"
 	"net/http"
+	"strings"
 )
 
-func authHelper(c *gin.Context, minRole int) {
+// getApiTokenUser 通过 Authorization 请求头中具有管理权限的 API 令牌获取用户，用户的角色与状态以数据库为准
+func getApiTokenUser(c *gin.Context) (*model.User, error) {
+	key := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+	token := model.GetApiTokenByKey(key)
+	if token == nil {
+		return nil, errors.New("无效的令牌")
+	}
+	if token.Scope != common.ApiTokenScopeManage || len(token.AllowedChannels) > 0 {
+		return nil, errors.New("该令牌无权调用管理接口")
+	}
+	err := token.Verify(c.ClientIP())
+	if err != nil {
+		return nil, err
+	}
+	user, err := model.GetUserById(token.UserId, false)
+	if err != nil {
+		return nil, err
+	}
+	err = token.UpdateLastUsedTime()
+	if err != nil {
+		common.SysError("failed to update the last used time of api token: " + err.Error())
+	}
+	return user, nil
+}
+
+// authHelper 校验登录状态，allowApiToken 为 true 时也接受 Authorization 请求头中的 API 令牌
+func authHelper(c *gin.Context, minRole int, allowApiToken bool) {
 	session := sessions.Default(c)
 	username := session.Get("username")
 	role := session.Get("role")
 	id := session.Get("id")
 	status := session.Get("status")
+	if username == nil && allowApiToken && c.Request.Header.Get("Authorization") != "" {
+		user, err := getApiTokenUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		username, role, id, status = user.Username, user.Role, user.Id, user.Status
+	}
 	if username == nil {
+		message := "无权进行此操作，未登录"
+		if c.Request.Header.Get("Authorization") != "" {
+			message = "该接口不支持通过 API 令牌调用，请登录后操作"
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
-			"message": "无权进行此操作，未登录",
+			"message": message,
 		})
 		c.Abort()
 		return
@@ -45,18 +90,26 @@ func authHelper(c *gin.Context, minRole int) {
 
 func UserAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, common.RoleCommonUser)
+		authHelper(c, common.RoleCommonUser, false)
+	}
+}
+
+// ResourceAuth 用于渠道、Webhook、消息以及定时任务等资源的管理接口，除登录外也接受具有管理权限的 API 令牌，
+// 账号、令牌以及系统设置相关的接口不接受令牌，避免令牌泄露后被用于接管账号
+func ResourceAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleCommonUser, true)
 	}
 }
 
 func AdminAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, common.RoleAdminUser)
+		authHelper(c, common.RoleAdminUser, false)
 	}
 }
 
 func RootAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, common.RoleRootUser)
+		authHelper(c, common.RoleRootUser, false)
 	}
 }
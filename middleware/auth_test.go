@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"message-pusher/common"
+	"message-pusher/model"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetApiTokenUser(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection has its own in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	defer sqlDB.Close()
+	err = db.AutoMigrate(&model.User{}, &model.ApiToken{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.DB = db
+	user := model.User{Username: "root", Role: common.RoleRootUser, Status: common.UserStatusEnabled}
+	if err = db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key   string
+		token model.ApiToken
+		valid bool
+	}{
+		{"manage", model.ApiToken{Scope: common.ApiTokenScopeManage}, true},
+		{"push", model.ApiToken{Scope: common.ApiTokenScopePush}, false},
+		// saved before the restriction was refused, it must not reach the channels it wasn't granted
+		{"restricted", model.ApiToken{Scope: common.ApiTokenScopeManage, AllowedChannels: []string{"lark"}}, false},
+		{"subnet", model.ApiToken{Scope: common.ApiTokenScopeManage, AllowedSubnets: []string{"10.0.0.0/8"}}, false},
+		{"expired", model.ApiToken{Scope: common.ApiTokenScopeManage, ExpiredTime: 1}, false},
+		{"disabled", model.ApiToken{Scope: common.ApiTokenScopeManage, Status: common.ApiTokenStatusDisabled}, false},
+	}
+	for _, test := range tests {
+		test.token.UserId = user.Id
+		test.token.Name = test.key
+		test.token.Key = common.HashToken(test.key)
+		if test.token.Status == 0 {
+			test.token.Status = common.ApiTokenStatusEnabled
+		}
+		if err = test.token.Insert(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	getUser := func(key string) (*model.User, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/api/channel/", nil)
+		c.Request.RemoteAddr = "192.168.1.2:1234"
+		c.Request.Header.Set("Authorization", "Bearer "+key)
+		return getApiTokenUser(c)
+	}
+	for _, test := range tests {
+		got, err := getUser(test.key)
+		if test.valid && (err != nil || got.Id != user.Id) {
+			t.Errorf("getApiTokenUser(%s) = %v, %v", test.key, got, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("getApiTokenUser(%s) should fail", test.key)
+		}
+	}
+	if _, err = getUser("unknown"); err == nil {
+		t.Errorf("getApiTokenUser(unknown) should fail")
+	}
+}
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"message-pusher/common"
+)
+
+// alertSendingTimeout is how long a notification reserved by a trigger can stay in flight before
+// another trigger takes it over, in case the server exited while sending, unit: second
+const alertSendingTimeout = 10 * 60
+
+// Alert tracks messages pushed with the same dedup key, so repeated triggers can be suppressed
+// and the resolve event can reference the original notification.
+type Alert struct {
+	Id           int    `json:"id"`
+	UserId       int    `json:"user_id" gorm:"uniqueIndex:idx_alert_user_key"`
+	DedupKey     string `json:"dedup_key" gorm:"type:varchar(64);uniqueIndex:idx_alert_user_key"`
+	Status       int    `json:"status" gorm:"default:1"` // firing, resolved
+	Title        string `json:"title"`
+	Count        int    `json:"count"` // number of triggers since the alert started firing
+	FirstTime    int64  `json:"first_time" gorm:"bigint"`
+	LastTime     int64  `json:"last_time" gorm:"bigint"`
+	LastSentTime int64  `json:"last_sent_time" gorm:"bigint"`         // 0 if no notification has been sent yet
+	MessageLink  string `json:"message_link" gorm:"type:varchar(32)"` // uuid of the last sent notification
+	ResolvedTime int64  `json:"resolved_time" gorm:"bigint"`
+	SendingTime  int64  `json:"-" gorm:"bigint"`                 // when the reserved notification is sent, 0 if none
+	SendingLink  string `json:"-" gorm:"type:varchar(32);index"` // uuid of the reserved notification sent later
+}
+
+// GetAlertByDedupKey returns nil if the user hasn't pushed any message with the key.
+func GetAlertByDedupKey(userId int, dedupKey string) (*Alert, error) {
+	alert := Alert{}
+	err := DB.Where(&Alert{UserId: userId, DedupKey: dedupKey}).First(&alert).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// IncreaseCount counts one more trigger of the firing alert.
+func (alert *Alert) IncreaseCount(now int64) error {
+	err := DB.Model(alert).Updates(map[string]interface{}{
+		"count":     gorm.Expr("count + 1"),
+		"last_time": now,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return DB.Select("count").First(alert, alert.Id).Error
+}
+
+// ReserveSend reserves the notification of the firing alert, so concurrent triggers won't all send it.
+// It returns false and reloads the alert if a notification is in flight or has been sent within window.
+func (alert *Alert) ReserveSend(now int64, window int64) (bool, error) {
+	result := DB.Model(&Alert{}).Where("id = ? and status = ?", alert.Id, common.AlertStatusFiring).
+		Where("sending_time = 0 or sending_time < ?", now-alertSendingTimeout).
+		Where("last_sent_time = 0 or last_sent_time <= ?", now-window).
+		Updates(map[string]interface{}{"sending_time": now, "sending_link": ""})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		alert.SendingTime = now
+		alert.SendingLink = ""
+		return true, nil
+	}
+	return false, DB.First(alert, alert.Id).Error
+}
+
+// Refire restarts the resolved alert and reserves its notification,
+// it returns false and reloads the alert if another request has restarted it.
+func (alert *Alert) Refire(title string, now int64) (bool, error) {
+	result := DB.Model(&Alert{}).Where("id = ? and status = ?", alert.Id, common.AlertStatusResolved).
+		Updates(map[string]interface{}{
+			"status":         common.AlertStatusFiring,
+			"title":          title,
+			"count":          1,
+			"first_time":     now,
+			"last_time":      now,
+			"last_sent_time": 0,
+			"resolved_time":  0,
+			"sending_time":   now,
+			"sending_link":   "",
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, DB.First(alert, alert.Id).Error
+}
+
+// updateReservedSend updates the alert only if the notification reserved by alert is still in flight.
+func (alert *Alert) updateReservedSend(updates map[string]interface{}) error {
+	return DB.Model(&Alert{}).Where("id = ? and sending_time = ?", alert.Id, alert.SendingTime).Updates(updates).Error
+}
+
+// CompleteSend records the reserved notification as sent.
+func (alert *Alert) CompleteSend(link string, now int64) error {
+	return alert.updateReservedSend(map[string]interface{}{
+		"last_sent_time": now,
+		"message_link":   link,
+		"sending_time":   0,
+		"sending_link":   "",
+	})
+}
+
+// ReleaseSend frees the reserved notification after it failed, so the next trigger sends it again.
+func (alert *Alert) ReleaseSend() error {
+	return alert.updateReservedSend(map[string]interface{}{"sending_time": 0, "sending_link": ""})
+}
+
+// DeferSend keeps the reservation until the async or scheduled message with link is sent at sendAt,
+// the sender completes it with CompleteAlertSendByLink.
+func (alert *Alert) DeferSend(link string, sendAt int64) error {
+	err := alert.updateReservedSend(map[string]interface{}{"sending_time": sendAt, "sending_link": link})
+	if err != nil {
+		return err
+	}
+	alert.SendingTime = sendAt
+	alert.SendingLink = link
+	return nil
+}
+
+// CompleteAlertSendByLink records the result of the deferred notification with link, if it belongs to an alert.
+func CompleteAlertSendByLink(userId int, link string, sent bool, now int64) error {
+	if link == "" {
+		return nil
+	}
+	updates := map[string]interface{}{"sending_time": 0, "sending_link": ""}
+	if sent {
+		updates["last_sent_time"] = now
+		updates["message_link"] = link
+	}
+	return DB.Model(&Alert{}).Where("user_id = ? and sending_link = ?", userId, link).Updates(updates).Error
+}
+
+// Resolve marks the firing alert as resolved, it returns false if another request has resolved it.
+func (alert *Alert) Resolve(now int64) (bool, error) {
+	result := DB.Model(&Alert{}).Where("id = ? and status = ?", alert.Id, common.AlertStatusFiring).
+		Updates(map[string]interface{}{"status": common.AlertStatusResolved, "resolved_time": now})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return false, nil
+	}
+	alert.Status = common.AlertStatusResolved
+	alert.ResolvedTime = now
+	return true, nil
+}
+
+// CancelResolve restores the alert to firing after the resolve notification failed,
+// unless it has been changed since.
+func (alert *Alert) CancelResolve() error {
+	return DB.Model(&Alert{}).Where("id = ? and status = ? and resolved_time = ?", alert.Id,
+		common.AlertStatusResolved, alert.ResolvedTime).
+		Updates(map[string]interface{}{"status": common.AlertStatusFiring, "resolved_time": 0}).Error
+}
+
+func (alert *Alert) Insert() error {
+	return DB.Create(alert).Error
+}
+
+// Update Make sure your alert's fields is completed, because this will update zero values
+func (alert *Alert) Update() error {
+	return DB.Model(alert).Select("status", "title", "count", "first_time", "last_time",
+		"last_sent_time", "message_link", "resolved_time").Updates(alert).Error
+}
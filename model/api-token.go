@@ -0,0 +1,136 @@
+package model
+
+import (
+	"errors"
+	"gorm.io/gorm/clause"
+	"message-pusher/common"
+	"net"
+)
+
+// ApiToken is a named token of a user, unlike User.Token it can be restricted and revoked on its own.
+type ApiToken struct {
+	Id              int      `json:"id"`
+	UserId          int      `json:"user_id" gorm:"index"`
+	Name            string   `json:"name" gorm:"type:varchar(32)"`
+	Key             string   `json:"key" gorm:"type:char(64);uniqueIndex"` // the hash of the key, see common.HashToken
+	Status          int      `json:"status" gorm:"default:1"`              // enabled, disabled
+	Scope           string   `json:"scope" gorm:"type:varchar(16)"`
+	ExpiredTime     int64    `json:"expired_time" gorm:"bigint"`                        // 0 means never expire
+	AllowedChannels []string `json:"allowed_channels" gorm:"type:text;serializer:json"` // empty means all channels
+	AllowedSubnets  []string `json:"allowed_subnets" gorm:"type:text;serializer:json"`  // CIDRs or IPs, empty means anywhere
+	CreatedTime     int64    `json:"created_time" gorm:"bigint"`
+	LastUsedTime    int64    `json:"last_used_time" gorm:"bigint"`
+}
+
+func GetApiTokensByUserId(userId int, startIdx int, num int) (tokens []*ApiToken, err error) {
+	err = DB.Omit("key").Where("user_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
+	return tokens, err
+}
+
+func GetApiTokenById(id int, userId int) (*ApiToken, error) {
+	if id == 0 || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	token := ApiToken{Id: id, UserId: userId}
+	err := DB.Omit("key").Where(token).First(&token).Error
+	return &token, err
+}
+
+// GetApiTokenByKey returns nil if the key doesn't belong to any token.
+func GetApiTokenByKey(key string) *ApiToken {
+	if key == "" {
+		return nil
+	}
+	token := ApiToken{}
+	if DB.Where(&ApiToken{Key: common.HashToken(key)}).First(&token).RowsAffected != 1 {
+		return nil
+	}
+	return &token
+}
+
+func DeleteApiTokenById(id int, userId int) error {
+	if id == 0 || userId == 0 {
+		return errors.New("id 或 userId 为空！")
+	}
+	return DB.Where("id = ? and user_id = ?", id, userId).Delete(&ApiToken{}).Error
+}
+
+func DeleteApiTokensByUserId(userId int) error {
+	return DB.Where("user_id = ?", userId).Delete(&ApiToken{}).Error
+}
+
+// HashPlaintextApiTokenKeys hashes the keys stored in plaintext before the keys are hashed.
+func HashPlaintextApiTokenKeys() (int, error) {
+	var tokens []*ApiToken
+	// plaintext keys are UUIDs without dashes, hashes are twice as long
+	err := DB.Select("id", "key").Where("LENGTH(?) = ?", clause.Column{Name: "key"}, 32).Find(&tokens).Error
+	if err != nil {
+		return 0, err
+	}
+	for _, token := range tokens {
+		err = DB.Model(token).Update("key", common.HashToken(token.Key)).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(tokens), nil
+}
+
+// Verify checks whether the token can be used from ip with all the channels, channels can be empty.
+func (token *ApiToken) Verify(ip string, channels ...string) error {
+	if token.Status != common.ApiTokenStatusEnabled {
+		return errors.New("该令牌已被禁用")
+	}
+	if token.ExpiredTime != 0 && token.ExpiredTime < common.GetTimestamp() {
+		return errors.New("该令牌已过期")
+	}
+	if len(token.AllowedSubnets) > 0 && !IsIPInSubnets(ip, token.AllowedSubnets) {
+		return errors.New("该令牌不允许从当前 IP 地址使用：" + ip)
+	}
+	if len(token.AllowedChannels) > 0 {
+		for _, channel := range channels {
+			allowed := false
+			for _, name := range token.AllowedChannels {
+				if name == channel {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return errors.New("该令牌无权使用该通道：" + channel)
+			}
+		}
+	}
+	return nil
+}
+
+// IsIPInSubnets reports whether ip is in one of the subnets, a subnet can also be a single IP.
+func IsIPInSubnets(ip string, subnets []string) bool {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return false
+	}
+	for _, subnet := range subnets {
+		if _, ipNet, err := net.ParseCIDR(subnet); err == nil {
+			if ipNet.Contains(parsedIP) {
+				return true
+			}
+		} else if subnetIP := net.ParseIP(subnet); subnetIP != nil && subnetIP.Equal(parsedIP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (token *ApiToken) Insert() error {
+	return DB.Create(token).Error
+}
+
+// Update Make sure your token's fields is completed, because this will update zero values
+func (token *ApiToken) Update() error {
+	return DB.Model(token).Select("name", "status", "scope", "expired_time", "allowed_channels", "allowed_subnets").Updates(token).Error
+}
+
+func (token *ApiToken) UpdateLastUsedTime() error {
+	return DB.Model(token).Update("last_used_time", common.GetTimestamp()).Error
+}
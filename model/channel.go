@@ -22,22 +22,40 @@ const (
 	TypeLarkApp           = "lark_app"
 	TypeCustom            = "custom"
 	TypeTencentAlarm      = "tencent_alarm"
+	TypeSlack             = "slack"
+	TypeTeams             = "teams"
+	TypeMatrix            = "matrix"
+	TypeNtfy              = "ntfy"
+	TypeGotify            = "gotify"
+	TypePushover          = "pushover"
+	TypePushDeer          = "pushdeer"
 )
 
+// RetryPolicy controls how failed deliveries are retried, zero fields fall back to the defaults.
+type RetryPolicy struct {
+	MaxAttempts  int     `json:"max_attempts"`  // including the first attempt, 1 means no retry
+	InitialDelay int     `json:"initial_delay"` // unit: millisecond
+	MaxDelay     int     `json:"max_delay"`     // unit: millisecond
+	Multiplier   float64 `json:"multiplier"`
+	Jitter       float64 `json:"jitter"` // 0 ~ 1, the fraction of each delay to randomize
+}
+
 type Channel struct {
-	Id          int     `json:"id"`
-	Type        string  `json:"type" gorm:"type:varchar(32)"`
-	UserId      int     `json:"user_id" gorm:"uniqueIndex:name_user_id;index"`
-	Name        string  `json:"name" gorm:"type:varchar(32);uniqueIndex:name_user_id"`
-	Description string  `json:"description"`
-	Status      int     `json:"status" gorm:"default:1"` // enabled, disabled
-	Secret      string  `json:"secret" gorm:"index"`
-	AppId       string  `json:"app_id"`
-	AccountId   string  `json:"account_id"`
-	URL         string  `json:"url" gorm:"column:url"`
-	Other       string  `json:"other"`
-	CreatedTime int64   `json:"created_time" gorm:"bigint"`
-	Token       *string `json:"token" gorm:"token"`
+	Id          int         `json:"id"`
+	Type        string      `json:"type" gorm:"type:varchar(32)"`
+	UserId      int         `json:"user_id" gorm:"uniqueIndex:name_user_id;index"`
+	Name        string      `json:"name" gorm:"type:varchar(32);uniqueIndex:name_user_id"`
+	Description string      `json:"description"`
+	Status      int         `json:"status" gorm:"default:1"` // enabled, disabled
+	Secret      string      `json:"secret" gorm:"serializer:encrypted"`
+	AppId       string      `json:"app_id"`
+	AccountId   string      `json:"account_id"`
+	URL         string      `json:"url" gorm:"column:url"`
+	Other       string      `json:"other"`
+	CreatedTime int64       `json:"created_time" gorm:"bigint"`
+	Token       *string     `json:"token" gorm:"serializer:encrypted"`
+	RetryPolicy RetryPolicy `json:"retry_policy" gorm:"type:text;serializer:json"`
+	Proxy       string      `json:"proxy" gorm:"serializer:encrypted"` // overrides the global OutboundProxy
 }
 
 type BriefChannel struct {
@@ -79,6 +97,18 @@ func GetTokenStoreChannelsByUserId(userId int) (channels []*Channel, err error)
 	return channels, err
 }
 
+// CountChannelsBySecret counts the channels of the app using secret, secrets are compared after decryption.
+func CountChannelsBySecret(type_ string, appId string, secret string) (count int) {
+	var channels []*Channel
+	DB.Select("secret").Where("app_id = ? and type = ?", appId, type_).Find(&channels)
+	for _, channel := range channels {
+		if channel.Secret == secret {
+			count++
+		}
+	}
+	return count
+}
+
 func GetChannelsByUserId(userId int, startIdx int, num int) (channels []*Channel, err error) {
 	err = DB.Omit("secret").Where("user_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&channels).Error
 	return channels, err
@@ -121,7 +151,7 @@ func (channel *Channel) UpdateStatus(status int) error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (channel *Channel) Update() error {
 	var err error
-	err = DB.Model(channel).Select("type", "name", "description", "secret", "app_id", "account_id", "url", "other", "status", "token").Updates(channel).Error
+	err = DB.Model(channel).Select("type", "name", "description", "secret", "app_id", "account_id", "url", "other", "status", "token", "retry_policy", "proxy").Updates(channel).Error
 	return err
 }
 
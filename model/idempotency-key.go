@@ -0,0 +1,144 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"message-pusher/common"
+	"time"
+)
+
+// idempotencyKeyReservationTimeout is how long a key can stay reserved by a request which hasn't completed,
+// after that a retry takes the key over, in case the server exited while processing, unit: second
+const idempotencyKeyReservationTimeout = 5 * 60
+
+// IdempotencyKey remembers the message pushed with the key, so a retried push won't be sent again.
+// It's stored in Redis when Redis is enabled, the table is used otherwise.
+type IdempotencyKey struct {
+	Id           int    `json:"-"`
+	UserId       int    `json:"-" gorm:"uniqueIndex:idx_idempotency_user_key"`
+	Key          string `json:"-" gorm:"type:varchar(64);uniqueIndex:idx_idempotency_user_key"`
+	Link         string `json:"link" gorm:"type:varchar(32)"` // empty while the first request is still being processed
+	Status       int    `json:"status"`
+	ReservedTime int64  `json:"reserved_time" gorm:"bigint"`
+	CreatedTime  int64  `json:"-" gorm:"bigint;index"`
+}
+
+func getIdempotencyRedisKey(userId int, key string) string {
+	return fmt.Sprintf("idempotency:%d:%s", userId, key)
+}
+
+// isReservationExpired reports whether the request which reserved the key is considered dead.
+func (record *IdempotencyKey) isReservationExpired(now int64) bool {
+	return record.Link == "" && record.ReservedTime < now-idempotencyKeyReservationTimeout
+}
+
+// ReserveIdempotencyKey returns nil if the key is reserved for this request,
+// otherwise the record of the earlier request with the same key is returned.
+// A reservation which isn't completed in time is taken over.
+func ReserveIdempotencyKey(userId int, key string) (*IdempotencyKey, error) {
+	window := int64(common.IdempotencyKeyWindow)
+	now := common.GetTimestamp()
+	if common.RedisEnabled {
+		ctx := context.Background()
+		redisKey := getIdempotencyRedisKey(userId, key)
+		value, _ := json.Marshal(IdempotencyKey{Status: common.MessageSendStatusPending, ReservedTime: now})
+		ok, err := common.RDB.SetNX(ctx, redisKey, value, time.Duration(window)*time.Second).Result()
+		if err != nil || ok {
+			return nil, err
+		}
+		var existing *IdempotencyKey
+		// the key is watched, so the takeover fails if another request changes it in between
+		err = common.RDB.Watch(ctx, func(tx *redis.Tx) error {
+			oldValue, err := tx.Get(ctx, redisKey).Bytes()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			if err == nil {
+				record := IdempotencyKey{}
+				err = json.Unmarshal(oldValue, &record)
+				if err != nil {
+					return err
+				}
+				if !record.isReservationExpired(now) {
+					existing = &record
+					return nil
+				}
+			}
+			// expired just now, or the reservation is expired
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, redisKey, value, time.Duration(window)*time.Second)
+				return nil
+			})
+			return err
+		}, redisKey)
+		if err == redis.TxFailedErr {
+			return ReserveIdempotencyKey(userId, key)
+		}
+		return existing, err
+	}
+	err := DB.Where("created_time < ?", now-window).Delete(&IdempotencyKey{}).Error
+	if err != nil {
+		return nil, err
+	}
+	record := IdempotencyKey{
+		UserId:       userId,
+		Key:          key,
+		Status:       common.MessageSendStatusPending,
+		ReservedTime: now,
+		CreatedTime:  now,
+	}
+	err = DB.Create(&record).Error
+	if err == nil {
+		return nil, nil
+	}
+	// The unique index is violated, the key has been used.
+	// Take over the reservation if it's expired, the condition makes sure only one request succeeds.
+	result := DB.Model(&IdempotencyKey{}).Where(&IdempotencyKey{UserId: userId, Key: key}).
+		Where("link = ? and reserved_time < ?", "", now-idempotencyKeyReservationTimeout).
+		Updates(map[string]interface{}{"reserved_time": now, "created_time": now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil, nil
+	}
+	existing := IdempotencyKey{}
+	if DB.Where(&IdempotencyKey{UserId: userId, Key: key}).First(&existing).Error != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// CompleteIdempotencyKey records the result of the request which reserved the key.
+func CompleteIdempotencyKey(userId int, key string, link string, status int) error {
+	if common.RedisEnabled {
+		value, _ := json.Marshal(IdempotencyKey{Link: link, Status: status})
+		return common.RDB.Set(context.Background(), getIdempotencyRedisKey(userId, key), value, redis.KeepTTL).Err()
+	}
+	return DB.Model(&IdempotencyKey{}).Where(&IdempotencyKey{UserId: userId, Key: key}).
+		Updates(map[string]interface{}{"link": link, "status": status}).Error
+}
+
+// ReleaseIdempotencyKey frees the key when the request is rejected before a message is created,
+// so the caller can fix the request and retry with the same key.
+func ReleaseIdempotencyKey(userId int, key string) error {
+	if common.RedisEnabled {
+		return common.RDB.Del(context.Background(), getIdempotencyRedisKey(userId, key)).Err()
+	}
+	return DB.Where(&IdempotencyKey{UserId: userId, Key: key}).Delete(&IdempotencyKey{}).Error
+}
+
+// GetLatestStatus returns the current status of the message if it's persisted,
+// e.g. an async message may have been sent since the key was completed.
+func (record *IdempotencyKey) GetLatestStatus() int {
+	if record.Link == "" || record.Link == "unsaved" {
+		return record.Status
+	}
+	status, err := GetMessageStatusByLink(record.Link)
+	if err != nil {
+		return record.Status
+	}
+	return status
+}
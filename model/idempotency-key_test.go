@@ -0,0 +1,86 @@
+package model
+
+import (
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"message-pusher/common"
+	"testing"
+)
+
+func openTestDB(t *testing.T, models ...interface{}) {
+	// Redis is enabled until the client is initialized
+	common.RedisEnabled = false
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection has its own in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(models...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	DB = db
+	t.Cleanup(func() {
+		_ = sqlDB.Close()
+	})
+}
+
+func TestReserveIdempotencyKey(t *testing.T) {
+	openTestDB(t, &IdempotencyKey{})
+	expire := func(key string) {
+		err := DB.Model(&IdempotencyKey{}).Where(&IdempotencyKey{UserId: 1, Key: key}).
+			Update("reserved_time", common.GetTimestamp()-idempotencyKeyReservationTimeout-1).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	reserve := func(key string) *IdempotencyKey {
+		existing, err := ReserveIdempotencyKey(1, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return existing
+	}
+
+	if existing := reserve("a"); existing != nil {
+		t.Fatalf("the first request should reserve the key, got %+v", existing)
+	}
+	if existing := reserve("a"); existing == nil || existing.Link != "" {
+		t.Fatalf("the key should be in progress, got %+v", existing)
+	}
+	// the first request died without completing the key
+	expire("a")
+	if existing := reserve("a"); existing != nil {
+		t.Fatalf("the expired reservation should be taken over, got %+v", existing)
+	}
+	if existing := reserve("a"); existing == nil || existing.Link != "" {
+		t.Fatalf("the key should be in progress again after the takeover, got %+v", existing)
+	}
+
+	// completed keys are never taken over
+	if existing := reserve("b"); existing != nil {
+		t.Fatalf("the first request should reserve the key, got %+v", existing)
+	}
+	err := CompleteIdempotencyKey(1, "b", "link", common.MessageSendStatusSent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expire("b")
+	if existing := reserve("b"); existing == nil || existing.Link != "link" || existing.Status != common.MessageSendStatusSent {
+		t.Fatalf("the completed key should be returned, got %+v", existing)
+	}
+
+	// released keys can be reserved again
+	err = ReleaseIdempotencyKey(1, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if existing := reserve("b"); existing != nil {
+		t.Fatalf("the released key should be reserved again, got %+v", existing)
+	}
+}
@@ -0,0 +1,39 @@
+package model
+
+// ScheduledJobRunHistoryLimit is the number of runs kept for each job.
+var ScheduledJobRunHistoryLimit = 100
+
+// ScheduledJobRun records one run of a scheduled job.
+type ScheduledJobRun struct {
+	Id            int    `json:"id"`
+	JobId         int    `json:"job_id" gorm:"index"`
+	ScheduledTime int64  `json:"scheduled_time" gorm:"bigint"` // when the job was due
+	StartedTime   int64  `json:"started_time" gorm:"bigint"`
+	Status        int    `json:"status" gorm:"default:0"` // same as Message.Status
+	Error         string `json:"error"`
+	MessageLink   string `json:"message_link" gorm:"type:varchar(32)"` // uuid of the pushed message, "unsaved" if not persisted
+}
+
+func GetScheduledJobRunsByJobId(jobId int, startIdx int, num int) (runs []*ScheduledJobRun, err error) {
+	err = DB.Where("job_id = ?", jobId).Order("id desc").Limit(num).Offset(startIdx).Find(&runs).Error
+	return runs, err
+}
+
+func DeleteScheduledJobRunsByJobId(jobId int) error {
+	return DB.Where("job_id = ?", jobId).Delete(&ScheduledJobRun{}).Error
+}
+
+// Insert saves the run and drops the runs beyond ScheduledJobRunHistoryLimit.
+func (run *ScheduledJobRun) Insert() error {
+	err := DB.Create(run).Error
+	if err != nil {
+		return err
+	}
+	var ids []int
+	err = DB.Model(&ScheduledJobRun{}).Where("job_id = ?", run.JobId).Order("id desc").
+		Offset(ScheduledJobRunHistoryLimit).Limit(ScheduledJobRunHistoryLimit).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return DB.Where("id in ?", ids).Delete(&ScheduledJobRun{}).Error
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"errors"
+	"message-pusher/common"
+)
+
+// ScheduledJob pushes a message through the channel every time the cron expression matches.
+type ScheduledJob struct {
+	Id             int    `json:"id"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	Name           string `json:"name" gorm:"type:varchar(32);index"`
+	Status         int    `json:"status" gorm:"default:1"` // enabled, disabled
+	CronExpression string `json:"cron_expression" gorm:"type:varchar(64);not null"`
+	Timezone       string `json:"timezone" gorm:"type:varchar(64)"` // IANA name, empty means the server's timezone
+	Channel        string `json:"channel" gorm:"type:varchar(32)"`  // empty means the user's default channel
+	// the message template
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Content     string `json:"content"`
+	URL         string `json:"url" gorm:"column:url"`
+	To          string `json:"to" gorm:"column:to"`
+	RenderMode  string `json:"render_mode"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	LastRunTime int64  `json:"last_run_time" gorm:"bigint"`
+	LastStatus  int    `json:"last_status" gorm:"default:0"` // status of the last message, same as Message.Status
+	NextRunTime int64  `json:"next_run_time" gorm:"bigint;index"`
+}
+
+func GetScheduledJobById(id int, userId int) (*ScheduledJob, error) {
+	if id == 0 || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	job := ScheduledJob{Id: id, UserId: userId}
+	err := DB.Where(job).First(&job).Error
+	return &job, err
+}
+
+func GetScheduledJobsByUserId(userId int, startIdx int, num int) (jobs []*ScheduledJob, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&jobs).Error
+	return jobs, err
+}
+
+func GetDueScheduledJobs(now int64) (jobs []*ScheduledJob, err error) {
+	err = DB.Where("status = ? and next_run_time > 0 and next_run_time <= ?", common.ScheduledJobStatusEnabled, now).Find(&jobs).Error
+	return jobs, err
+}
+
+// ClaimScheduledJob moves the job's next run time forward, it returns false if
+// another instance sharing the database has claimed this run or the job has been changed.
+func ClaimScheduledJob(job *ScheduledJob, nextRunTime int64, now int64) (bool, error) {
+	result := DB.Model(&ScheduledJob{}).Where("id = ? and status = ? and next_run_time = ?", job.Id, common.ScheduledJobStatusEnabled, job.NextRunTime).
+		Updates(map[string]interface{}{"next_run_time": nextRunTime, "last_run_time": now})
+	if result.RowsAffected == 1 {
+		job.NextRunTime = nextRunTime
+		job.LastRunTime = now
+	}
+	return result.RowsAffected == 1, result.Error
+}
+
+func DeleteScheduledJobById(id int, userId int) (job *ScheduledJob, err error) {
+	if id == 0 || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	job = &ScheduledJob{Id: id, UserId: userId}
+	err = DB.Where(job).First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return job, job.Delete()
+}
+
+func (job *ScheduledJob) Insert() error {
+	return DB.Create(job).Error
+}
+
+func (job *ScheduledJob) UpdateLastStatus(status int) error {
+	return DB.Model(job).Update("last_status", status).Error
+}
+
+// Update Make sure your job's fields is completed, because this will update zero values
+func (job *ScheduledJob) Update() error {
+	return DB.Model(job).Select("status", "name", "cron_expression", "timezone", "channel", "title",
+		"description", "content", "url", "to", "render_mode", "next_run_time").Updates(job).Error
+}
+
+func (job *ScheduledJob) Delete() error {
+	err := DB.Delete(job).Error
+	if err != nil {
+		return err
+	}
+	return DeleteScheduledJobRunsByJobId(job.Id)
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -68,10 +69,63 @@ func InitDB() (err error) {
 		if err != nil {
 			return err
 		}
+		if db.Migrator().HasIndex(&Channel{}, "idx_channels_secret") {
+			// secrets are encrypted with random nonces, the index can't be used
+			err = db.Migrator().DropIndex(&Channel{}, "idx_channels_secret")
+			if err != nil {
+				return err
+			}
+		}
 		err = db.AutoMigrate(&Webhook{})
 		if err != nil {
 			return err
 		}
+		err = db.AutoMigrate(&MessageAttempt{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&MessageDelivery{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&ScheduledJob{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&ScheduledJobRun{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&IdempotencyKey{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&Alert{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&WebhookRequest{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&ApiToken{})
+		if err != nil {
+			return err
+		}
+		count, err := HashPlaintextApiTokenKeys()
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			common.SysLog(fmt.Sprintf("%d api token keys stored in plaintext are hashed", count))
+		}
+		count, err = EncryptSecrets()
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			common.SysLog(fmt.Sprintf("%d secrets stored in plaintext are encrypted", count))
+		}
 		err = createRootAccountIfNeed()
 		return err
 	} else {
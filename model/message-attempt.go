@@ -0,0 +1,30 @@
+package model
+
+// MessageAttempt records one try to deliver a message through a channel.
+type MessageAttempt struct {
+	Id        int    `json:"id"`
+	MessageId int    `json:"message_id" gorm:"index"`
+	Channel   string `json:"channel" gorm:"type:varchar(32)"`
+	Target    string `json:"target"`
+	Attempt   int    `json:"attempt"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error"`
+	Timestamp int64  `json:"timestamp" gorm:"type:bigint"`
+}
+
+func GetMessageAttemptsByMessageId(messageId int) (attempts []*MessageAttempt, err error) {
+	err = DB.Where("message_id = ?", messageId).Order("id asc").Find(&attempts).Error
+	return attempts, err
+}
+
+func DeleteMessageAttemptsByMessageId(messageId int) error {
+	return DB.Where("message_id = ?", messageId).Delete(&MessageAttempt{}).Error
+}
+
+func DeleteAllMessageAttempts() error {
+	return DB.Exec("DELETE FROM message_attempts").Error
+}
+
+func (attempt *MessageAttempt) Insert() error {
+	return DB.Create(attempt).Error
+}
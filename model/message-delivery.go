@@ -0,0 +1,42 @@
+package model
+
+// MessageDelivery is the outcome of delivering a message to one target of one channel,
+// a group message has one delivery per sub channel.
+type MessageDelivery struct {
+	Id          int    `json:"id"`
+	MessageId   int    `json:"message_id" gorm:"index"`
+	Channel     string `json:"channel" gorm:"type:varchar(32)"`
+	Target      string `json:"target"`
+	Status      int    `json:"status" gorm:"default:0"` // sent, failed
+	Attempts    int    `json:"attempts"`
+	LastError   string `json:"last_error"`
+	RemoteId    string `json:"remote_id"` // message id returned by the upstream API, if any
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+func GetMessageDeliveriesByMessageId(messageId int) (deliveries []*MessageDelivery, err error) {
+	err = DB.Where("message_id = ?", messageId).Order("id asc").Find(&deliveries).Error
+	return deliveries, err
+}
+
+func DeleteMessageDeliveriesByMessageId(messageId int) error {
+	return DB.Where("message_id = ?", messageId).Delete(&MessageDelivery{}).Error
+}
+
+func DeleteAllMessageDeliveries() error {
+	return DB.Exec("DELETE FROM message_deliveries").Error
+}
+
+// Save updates the existing delivery of the same target (e.g. when an async message is reloaded),
+// the attempts are accumulated.
+func (delivery *MessageDelivery) Save() error {
+	old := MessageDelivery{}
+	err := DB.Where("message_id = ? and channel = ? and target = ?",
+		delivery.MessageId, delivery.Channel, delivery.Target).First(&old).Error
+	if err == nil {
+		delivery.Id = old.Id
+		delivery.Attempts += old.Attempts
+		return DB.Save(delivery).Error
+	}
+	return DB.Create(delivery).Error
+}
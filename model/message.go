@@ -7,26 +7,39 @@ import (
 )
 
 type Message struct {
-	Id          int       `json:"id"`
-	UserId      int       `json:"user_id" gorm:"index"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Content     string    `json:"content"`
-	URL         string    `json:"url" gorm:"column:url"`
-	Btntxt      string    `json:"btntxt"`
-	Channel     string    `json:"channel"`
-	Token       string    `json:"token" gorm:"-:all"`
-	HTMLContent string    `json:"html_content"  gorm:"-:all"`
-	Timestamp   int64     `json:"timestamp" gorm:"type:bigint"`
-	Link        string    `json:"link" gorm:"unique;index"`
-	To          string    `json:"to" gorm:"column:to"`           // if specified, will send to this user(s)
-	Status      int       `json:"status" gorm:"default:0;index"` // pending, sent, failed
-	OpenId      string    `json:"openid" gorm:"-:all"`           // alias for to
-	Desp        string    `json:"desp" gorm:"-:all"`             // alias for content
-	Short       string    `json:"short" gorm:"-:all"`            // alias for description
-	Async       bool      `json:"async" gorm:"-"`                // if true, will send message asynchronously
-	RenderMode  string    `json:"render_mode" gorm:"raw"`        // markdown (default), code, raw
-	Articles    []Article `gorm:"type:json;serializer:json"`     // 通用文章列表，支持 news 和 mpnews 消息类型
+	Id            int       `json:"id"`
+	UserId        int       `json:"user_id" gorm:"index"`
+	Title         string    `json:"title"`
+	Description   string    `json:"description"`
+	Content       string    `json:"content"`
+	URL           string    `json:"url" gorm:"column:url"`
+	Btntxt        string    `json:"btntxt"`
+	Channel       string    `json:"channel"`
+	Token         string    `json:"token" gorm:"-:all"`
+	HTMLContent   string    `json:"html_content"  gorm:"-:all"`
+	Timestamp     int64     `json:"timestamp" gorm:"type:bigint"`
+	Link          string    `json:"link" gorm:"unique;index"`
+	To            string    `json:"to" gorm:"column:to"`              // if specified, will send to this user(s)
+	Status        int       `json:"status" gorm:"default:0;index"`    // pending, sent, failed
+	ClaimedTime   int64     `json:"-" gorm:"type:bigint;default:0"`   // when an async sender claimed it, 0 if it's sent synchronously
+	OpenId        string    `json:"openid" gorm:"-:all"`              // alias for to
+	Desp          string    `json:"desp" gorm:"-:all"`                // alias for content
+	Short         string    `json:"short" gorm:"-:all"`               // alias for description
+	Async         bool      `json:"async" gorm:"-"`                   // if true, will send message asynchronously
+	RenderMode    string    `json:"render_mode" gorm:"raw"`           // markdown (default), code, raw
+	Priority      int       `json:"priority" gorm:"default:0"`        // 1 (min) to 5 (urgent), 0 for the channel's default
+	SendAt        int64     `json:"send_at" gorm:"type:bigint;index"` // if in the future, the message will be scheduled
+	Delay         string    `json:"delay" gorm:"-:all"`               // alternative to send_at, e.g. 30m, or seconds
+	Articles      []Article `gorm:"type:json;serializer:json"`        // 通用文章列表，支持 news 和 mpnews 消息类型
+	RemoteId      string    `json:"-" gorm:"-:all"`                   // set by the channel, the upstream message id of the last delivery
+	SendId        string    `json:"-" gorm:"-:all"`                   // set by channel.SendMessageWithRetry, unique for each send and kept across its retries
+	RetryDeadline time.Time `json:"-" gorm:"-:all"`                   // set by channel.SendMessageWithRetry, shared by the sub channels of a group
+	// a retried push with the same key returns the first message instead of sending again
+	IdempotencyKey string `json:"idempotency_key" gorm:"-:all"`
+	// messages with the same dedup key are treated as one alert, see controller/alert.go
+	DedupKey string `json:"dedup_key" gorm:"-:all"`
+	Event    string `json:"event" gorm:"-:all"`   // trigger (default), resolve
+	DryRun   bool   `json:"dry_run" gorm:"-:all"` // if true, return the request the channel would send instead of sending it
 }
 
 type Article struct {
@@ -67,6 +80,76 @@ func GetAsyncPendingMessageIds() (ids []int, err error) {
 	return ids, err
 }
 
+// ClaimAsyncMessage marks the async pending message as being sent, so other instances sharing
+// the database won't send it again. A message left pending by a dead worker can be reclaimed.
+func ClaimAsyncMessage(id int, reclaim bool) (bool, error) {
+	statuses := []int{common.MessageSendStatusAsyncPending}
+	if reclaim {
+		statuses = append(statuses, common.MessageSendStatusPending)
+	}
+	result := DB.Model(&Message{}).Where("id = ? and status in ?", id, statuses).
+		Updates(map[string]interface{}{"status": common.MessageSendStatusPending, "claimed_time": common.GetTimestamp()})
+	return result.RowsAffected == 1, result.Error
+}
+
+// ResetStaleAsyncMessages turns the async messages claimed before the given time but never finished,
+// e.g. the instance crashed while sending them, back to async pending.
+func ResetStaleAsyncMessages(before int64) (int64, error) {
+	result := DB.Model(&Message{}).Where("status = ? and claimed_time > 0 and claimed_time < ?", common.MessageSendStatusPending, before).
+		Update("status", common.MessageSendStatusAsyncPending)
+	return result.RowsAffected, result.Error
+}
+
+func GetDueScheduledMessageIds(now int64) (ids []int, err error) {
+	err = DB.Model(&Message{}).Where("status = ? and send_at <= ?", common.MessageSendStatusScheduled, now).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// DispatchScheduledMessage turns the due scheduled message into an async pending one,
+// it returns false if the message has been dispatched by another instance or canceled.
+func DispatchScheduledMessage(id int) (bool, error) {
+	result := DB.Model(&Message{}).Where("id = ? and status = ?", id, common.MessageSendStatusScheduled).
+		Update("status", common.MessageSendStatusAsyncPending)
+	return result.RowsAffected == 1, result.Error
+}
+
+func GetScheduledMessagesByUserId(userId int, startIdx int, num int) (messages []*Message, err error) {
+	err = DB.Select([]string{"id", "title", "channel", "timestamp", "status", "send_at"}).
+		Where("user_id = ? and status = ?", userId, common.MessageSendStatusScheduled).
+		Order("send_at asc").Limit(num).Offset(startIdx).Find(&messages).Error
+	return messages, err
+}
+
+func RescheduleMessage(id int, userId int, sendAt int64) error {
+	if id == 0 || userId == 0 {
+		return errors.New("id 或 userId 为空！")
+	}
+	result := DB.Model(&Message{}).Where("id = ? and user_id = ? and status = ?", id, userId, common.MessageSendStatusScheduled).
+		Update("send_at", sendAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("消息不存在或已不处于定时发送状态")
+	}
+	return nil
+}
+
+func CancelScheduledMessage(id int, userId int) error {
+	if id == 0 || userId == 0 {
+		return errors.New("id 或 userId 为空！")
+	}
+	result := DB.Model(&Message{}).Where("id = ? and user_id = ? and status = ?", id, userId, common.MessageSendStatusScheduled).
+		Update("status", common.MessageSendStatusCanceled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("消息不存在或已不处于定时发送状态")
+	}
+	return nil
+}
+
 func GetMessageByLink(link string) (*Message, error) {
 	if link == "" {
 		return nil, errors.New("link 为空！")
@@ -109,10 +192,26 @@ func DeleteMessageById(id int, userId int) (err error) {
 	if err != nil {
 		return err
 	}
+	err = DeleteMessageAttemptsByMessageId(message.Id)
+	if err != nil {
+		return err
+	}
+	err = DeleteMessageDeliveriesByMessageId(message.Id)
+	if err != nil {
+		return err
+	}
 	return message.Delete()
 }
 
 func DeleteAllMessages() error {
+	err := DeleteAllMessageAttempts()
+	if err != nil {
+		return err
+	}
+	err = DeleteAllMessageDeliveries()
+	if err != nil {
+		return err
+	}
 	return DB.Exec("DELETE FROM messages").Error
 }
 
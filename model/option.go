@@ -50,6 +50,10 @@ func InitOptionMap() {
 	common.OptionMap["WeChatAccountQRCodeImageURL"] = ""
 	common.OptionMap["TurnstileSiteKey"] = ""
 	common.OptionMap["TurnstileSecretKey"] = ""
+	common.OptionMap["IdempotencyKeyWindow"] = strconv.Itoa(common.IdempotencyKeyWindow)
+	common.OptionMap["AlertDedupWindow"] = strconv.Itoa(common.AlertDedupWindow)
+	common.OptionMap["OutboundAllowlist"] = ""
+	common.OptionMap["OutboundProxy"] = ""
 	common.OptionMapRWMutex.Unlock()
 	options, _ := AllOption()
 	for _, option := range options {
@@ -144,5 +148,19 @@ func updateOptionMap(key string, value string) {
 		common.TurnstileSiteKey = value
 	case "TurnstileSecretKey":
 		common.TurnstileSecretKey = value
+	case "OutboundAllowlist":
+		common.OutboundAllowlist = value
+	case "OutboundProxy":
+		common.OutboundProxy = value
+	case "IdempotencyKeyWindow":
+		intValue, err := strconv.Atoi(value)
+		if err == nil && intValue > 0 {
+			common.IdempotencyKeyWindow = intValue
+		}
+	case "AlertDedupWindow":
+		intValue, err := strconv.Atoi(value)
+		if err == nil && intValue >= 0 {
+			common.AlertDedupWindow = intValue
+		}
 	}
 }
@@ -0,0 +1,169 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"message-pusher/common"
+	"reflect"
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+}
+
+// EncryptedSerializer encrypts string fields on write and decrypts them on read, see common.EncryptSecret.
+type EncryptedSerializer struct{}
+
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	fieldValue := reflect.New(field.FieldType)
+	if dbValue != nil {
+		var value string
+		switch v := dbValue.(type) {
+		case []byte:
+			value = string(v)
+		case string:
+			value = v
+		default:
+			return fmt.Errorf("failed to scan encrypted value: %#v", dbValue)
+		}
+		plaintext, err := common.DecryptSecret(value)
+		if err != nil {
+			return err
+		}
+		if field.FieldType.Kind() == reflect.Ptr {
+			fieldValue.Elem().Set(reflect.ValueOf(&plaintext))
+		} else {
+			fieldValue.Elem().SetString(plaintext)
+		}
+	}
+	field.ReflectValueOf(ctx, dst).Set(fieldValue.Elem())
+	return nil
+}
+
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	switch v := fieldValue.(type) {
+	case string:
+		return common.EncryptSecret(v)
+	case *string:
+		if v == nil {
+			return nil, nil
+		}
+		return common.EncryptSecret(*v)
+	}
+	return nil, fmt.Errorf("invalid field type %T for EncryptedSerializer, only string supported", fieldValue)
+}
+
+// secretOptions are the options encrypted at rest, add new options holding credentials here.
+var secretOptions = map[string]bool{
+	"SMTPToken":          true,
+	"GitHubClientSecret": true,
+	"WeChatServerToken":  true,
+	"TurnstileSecretKey": true,
+	"OutboundProxy":      true, // may contain user:password@
+}
+
+func isSecretOption(key string) bool {
+	return secretOptions[key]
+}
+
+func (option *Option) BeforeSave(tx *gorm.DB) (err error) {
+	if isSecretOption(option.Key) {
+		option.Value, err = common.EncryptSecret(option.Value)
+	}
+	return err
+}
+
+func (option *Option) AfterFind(tx *gorm.DB) (err error) {
+	if isSecretOption(option.Key) {
+		option.Value, err = common.DecryptSecret(option.Value)
+	}
+	return err
+}
+
+// secretColumn is a column holding secrets, only the rows match filter are processed if it's set.
+type secretColumn struct {
+	table      string
+	primaryKey string
+	column     string
+	filter     func(primaryKey string) bool
+}
+
+var secretColumns = []secretColumn{
+	{table: "channels", primaryKey: "id", column: "secret"},
+	{table: "channels", primaryKey: "id", column: "token"},
+	{table: "channels", primaryKey: "id", column: "proxy"},
+	{table: "webhooks", primaryKey: "id", column: "secret"},
+	{table: "users", primaryKey: "id", column: "token"},
+	{table: "options", primaryKey: "key", column: "value", filter: isSecretOption},
+}
+
+func rawString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	}
+	return fmt.Sprint(value)
+}
+
+// updateSecrets rewrites the stored secrets which update changes,
+// tables are accessed by name so that the values are neither decrypted nor encrypted by the serializer and hooks.
+func updateSecrets(update func(value string) (string, bool, error)) (count int, err error) {
+	for _, secret := range secretColumns {
+		var rows []map[string]interface{}
+		err = DB.Table(secret.table).Select(secret.primaryKey, secret.column).Find(&rows).Error
+		if err != nil {
+			return count, err
+		}
+		for _, row := range rows {
+			primaryKey := rawString(row[secret.primaryKey])
+			if secret.filter != nil && !secret.filter(primaryKey) {
+				continue
+			}
+			newValue, ok, err := update(rawString(row[secret.column]))
+			if err != nil {
+				return count, fmt.Errorf("failed to process %s.%s of %s: %s", secret.table, secret.column, primaryKey, err.Error())
+			}
+			if !ok {
+				continue
+			}
+			err = DB.Table(secret.table).Where(clause.Eq{Column: clause.Column{Name: secret.primaryKey}, Value: row[secret.primaryKey]}).
+				Update(secret.column, newValue).Error
+			if err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// EncryptSecrets encrypts the secrets still stored in plaintext if encryption is enabled,
+// and makes sure the master keys of the encrypted secrets are all available.
+func EncryptSecrets() (int, error) {
+	return updateSecrets(func(value string) (string, bool, error) {
+		if common.IsSecretEncrypted(value) {
+			return value, false, common.CheckSecretKey(value)
+		}
+		if value == "" || !common.IsEncryptionEnabled() {
+			return value, false, nil
+		}
+		encrypted, err := common.EncryptSecret(value)
+		return encrypted, err == nil, err
+	})
+}
+
+// RotateSecrets re-encrypts the data keys of secrets encrypted with old master keys using the current one.
+func RotateSecrets() (int, error) {
+	if !common.IsEncryptionEnabled() {
+		return 0, errors.New("ENCRYPTION_KEY is not set")
+	}
+	return updateSecrets(common.RewrapSecret)
+}
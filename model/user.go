@@ -3,7 +3,6 @@ package model
 import (
 	"errors"
 	"message-pusher/common"
-	"strings"
 )
 
 // User if you add sensitive fields, don't forget to clean them in setupLogin function.
@@ -15,7 +14,7 @@ type User struct {
 	DisplayName           string `json:"display_name" gorm:"index" validate:"max=20"`
 	Role                  int    `json:"role" gorm:"type:int;default:1"`   // admin, common
 	Status                int    `json:"status" gorm:"type:int;default:1"` // enabled, disabled
-	Token                 string `json:"token"`
+	Token                 string `json:"token" gorm:"serializer:encrypted"`
 	Email                 string `json:"email" gorm:"index" validate:"max=50"`
 	GitHubId              string `json:"github_id" gorm:"column:github_id;index"`
 	WeChatId              string `json:"wechat_id" gorm:"column:wechat_id;index"`
@@ -97,7 +96,10 @@ func (user *User) Delete() error {
 		return errors.New("id 为空！")
 	}
 	err := DB.Delete(user).Error
-	return err
+	if err != nil {
+		return err
+	}
+	return DeleteApiTokensByUserId(user.Id)
 }
 
 // ValidateAndFill check password & user status
@@ -157,18 +159,6 @@ func (user *User) FillUserByUsername() error {
 	return nil
 }
 
-func ValidateUserToken(token string) (user *User) {
-	if token == "" {
-		return nil
-	}
-	token = strings.Replace(token, "Bearer ", "", 1)
-	user = &User{}
-	if DB.Where("token = ?", token).First(user).RowsAffected == 1 {
-		return user
-	}
-	return nil
-}
-
 func IsEmailAlreadyTaken(email string) bool {
 	return DB.Where("email = ?", email).Find(&User{}).RowsAffected == 1
 }
@@ -0,0 +1,477 @@
+package model
+
+import (
+	"encoding/json"
+	"message-pusher/common"
+	"net/http"
+	"sort"
+)
+
+// WebhookPreset bundles the rules for a well-known sender, so users don't have to write them.
+// The rules are picked by the value of EventHeader, presets without EventHeader have a single event "".
+type WebhookPreset struct {
+	Name            string                         `json:"name"`
+	Label           string                         `json:"label"`
+	EventHeader     string                         `json:"event_header"`
+	VerifyScheme    string                         `json:"verify_scheme"` // used if the webhook has a secret but no verify scheme
+	SignatureHeader string                         `json:"signature_header"`
+	Events          map[string]*WebhookPresetEvent `json:"-"`
+}
+
+// WebhookPresetEvent describes how to build the message for one event,
+// the message fields are text/template snippets rendered with the same data as construct rule templates.
+type WebhookPresetEvent struct {
+	ExtractRule map[string]string
+	Filter      string
+	Title       string
+	Description string
+	Content     string
+	URL         string
+}
+
+func (event *WebhookPresetEvent) constructRule() string {
+	constructRule, _ := json.Marshal(WebhookConstructRule{
+		Title:       event.Title,
+		Description: event.Description,
+		Content:     event.Content,
+		URL:         event.URL,
+	})
+	return string(constructRule)
+}
+
+// EventNames returns the supported events in order.
+func (preset *WebhookPreset) EventNames() []string {
+	names := make([]string, 0, len(preset.Events))
+	for name := range preset.Events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func GetWebhookPreset(name string) (*WebhookPreset, bool) {
+	preset, ok := WebhookPresets[name]
+	return preset, ok
+}
+
+// GetWebhookPresets returns all presets ordered by name.
+func GetWebhookPresets() []*WebhookPreset {
+	presets := make([]*WebhookPreset, 0, len(WebhookPresets))
+	for _, preset := range WebhookPresets {
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool {
+		return presets[i].Name < presets[j].Name
+	})
+	return presets
+}
+
+// ApplyPreset returns a copy of the webhook with the rules of its preset for the request's event,
+// the webhook's own filter and routes still apply. It returns false if the preset doesn't support the event.
+func (webhook *Webhook) ApplyPreset(header http.Header) (*Webhook, bool) {
+	if webhook.Preset == "" {
+		return webhook, true
+	}
+	preset, ok := GetWebhookPreset(webhook.Preset)
+	if !ok {
+		return nil, false
+	}
+	eventName := ""
+	if preset.EventHeader != "" {
+		eventName = header.Get(preset.EventHeader)
+	}
+	event, ok := preset.Events[eventName]
+	if !ok {
+		return nil, false
+	}
+	extractRule, _ := json.Marshal(event.ExtractRule)
+	resolved := *webhook
+	resolved.ExtractRule = string(extractRule)
+	resolved.ConstructRule = event.constructRule()
+	resolved.TemplateEnabled = false
+	resolved.FieldTemplates = true
+	if event.Filter != "" && webhook.Filter != "" {
+		resolved.Filter = "(" + event.Filter + ") && (" + webhook.Filter + ")"
+	} else if event.Filter != "" {
+		resolved.Filter = event.Filter
+	}
+	return &resolved, true
+}
+
+const (
+	presetPushCommits = `{{ with .body.commits }}{{ range . }}- [{{ slice .id 0 7 }}]({{ .url }}) {{ firstLine .message }}（{{ .author.name }}）{{ "\n" }}{{ end }}{{ end }}`
+	presetChangeBody  = `**{{ .vars.title }}**{{ with .vars.body }}{{ "\n\n" }}{{ . | truncate 500 }}{{ end }}`
+)
+
+var githubPullRequestEvent = &WebhookPresetEvent{
+	ExtractRule: map[string]string{
+		"repo":   "repository.full_name",
+		"action": "action",
+		"number": "number",
+		"title":  "pull_request.title",
+		"body":   "pull_request.body",
+		"user":   "sender.login",
+		"merged": "pull_request.merged",
+		"url":    "pull_request.html_url",
+		"head":   "pull_request.head.ref",
+		"base":   "pull_request.base.ref",
+	},
+	Filter: "$action in [opened, closed, reopened, ready_for_review]",
+	Title: `[{{ .vars.repo }}] {{ .vars.user }} ` +
+		`{{ if eq .vars.action "closed" }}{{ if eq .vars.merged "true" }}合并了{{ else }}关闭了{{ end }}` +
+		`{{ else if eq .vars.action "reopened" }}重新打开了{{ else if eq .vars.action "ready_for_review" }}请求评审{{ else }}创建了{{ end }}` +
+		` PR #{{ .vars.number }}`,
+	Description: `{{ .vars.title }}`,
+	Content:     presetChangeBody + `{{ "\n\n" }}{{ .vars.head }} → {{ .vars.base }}`,
+	URL:         `{{ .vars.url }}`,
+}
+
+var githubIssuesEvent = &WebhookPresetEvent{
+	ExtractRule: map[string]string{
+		"repo":   "repository.full_name",
+		"action": "action",
+		"number": "issue.number",
+		"title":  "issue.title",
+		"body":   "issue.body",
+		"user":   "sender.login",
+		"url":    "issue.html_url",
+	},
+	Filter: "$action in [opened, closed, reopened]",
+	Title: `[{{ .vars.repo }}] {{ .vars.user }} ` +
+		`{{ if eq .vars.action "closed" }}关闭了{{ else if eq .vars.action "reopened" }}重新打开了{{ else }}创建了{{ end }}` +
+		` Issue #{{ .vars.number }}`,
+	Description: `{{ .vars.title }}`,
+	Content:     presetChangeBody,
+	URL:         `{{ .vars.url }}`,
+}
+
+var githubIssueCommentEvent = &WebhookPresetEvent{
+	ExtractRule: map[string]string{
+		"repo":   "repository.full_name",
+		"action": "action",
+		"number": "issue.number",
+		"title":  "issue.title",
+		"user":   "comment.user.login",
+		"body":   "comment.body",
+		"url":    "comment.html_url",
+	},
+	Filter:      "$action == 'created'",
+	Title:       `[{{ .vars.repo }}] {{ .vars.user }} 评论了 #{{ .vars.number }}`,
+	Description: `{{ .vars.title }}`,
+	Content:     `{{ .vars.body | truncate 500 }}`,
+	URL:         `{{ .vars.url }}`,
+}
+
+var githubReleaseEvent = &WebhookPresetEvent{
+	ExtractRule: map[string]string{
+		"repo":       "repository.full_name",
+		"action":     "action",
+		"tag":        "release.tag_name",
+		"name":       "release.name",
+		"body":       "release.body",
+		"prerelease": "release.prerelease",
+		"url":        "release.html_url",
+	},
+	Filter:      "$action == 'published'",
+	Title:       `[{{ .vars.repo }}] 发布了 {{ .vars.tag }}{{ if eq .vars.prerelease "true" }}（预发布）{{ end }}`,
+	Description: `{{ .vars.name | default .vars.tag }}`,
+	Content:     `{{ .vars.body | truncate 1000 }}`,
+	URL:         `{{ .vars.url }}`,
+}
+
+var githubPreset = &WebhookPreset{
+	Name:         "github",
+	Label:        "GitHub",
+	EventHeader:  "X-GitHub-Event",
+	VerifyScheme: common.WebhookVerifySchemeGitHub,
+	Events: map[string]*WebhookPresetEvent{
+		"ping": {
+			ExtractRule: map[string]string{"repo": "repository.full_name", "zen": "zen"},
+			Title:       `[{{ .vars.repo | default "GitHub" }}] Webhook 配置成功`,
+			Description: `{{ .vars.zen }}`,
+		},
+		"push": {
+			ExtractRule: map[string]string{
+				"repo":    "repository.full_name",
+				"ref":     "ref",
+				"pusher":  "pusher.name",
+				"count":   "commits.#",
+				"deleted": "deleted",
+				"compare": "compare",
+			},
+			// Branch deletions and tag pushes have no commits
+			Filter:  "$deleted != 'true' && $count > 0",
+			Title:   `[{{ .vars.repo }}] {{ .vars.pusher }} 推送了 {{ .vars.count }} 个提交到 {{ .vars.ref | trimPrefix "refs/heads/" }}`,
+			Content: presetPushCommits,
+			URL:     `{{ .vars.compare }}`,
+		},
+		"pull_request":  githubPullRequestEvent,
+		"issues":        githubIssuesEvent,
+		"issue_comment": githubIssueCommentEvent,
+		"release":       githubReleaseEvent,
+		"workflow_run": {
+			ExtractRule: map[string]string{
+				"repo":       "repository.full_name",
+				"action":     "action",
+				"name":       "workflow_run.name",
+				"number":     "workflow_run.run_number",
+				"branch":     "workflow_run.head_branch",
+				"conclusion": "workflow_run.conclusion",
+				"actor":      "workflow_run.actor.login",
+				"url":        "workflow_run.html_url",
+			},
+			Filter: "$action == 'completed'",
+			Title: `[{{ .vars.repo }}] 工作流 {{ .vars.name }} #{{ .vars.number }} ` +
+				`{{ if eq .vars.conclusion "success" }}运行成功{{ else if eq .vars.conclusion "failure" }}运行失败` +
+				`{{ else if eq .vars.conclusion "cancelled" }}已取消{{ else }}已结束（{{ .vars.conclusion }}）{{ end }}`,
+			Description: `分支 {{ .vars.branch }}，由 {{ .vars.actor }} 触发`,
+			URL:         `{{ .vars.url }}`,
+		},
+	},
+}
+
+// Gitea's payloads are compatible with GitHub's except for pushes.
+var giteaPreset = &WebhookPreset{
+	Name:            "gitea",
+	Label:           "Gitea",
+	EventHeader:     "X-Gitea-Event",
+	VerifyScheme:    common.WebhookVerifySchemeHMAC,
+	SignatureHeader: "X-Gitea-Signature",
+	Events: map[string]*WebhookPresetEvent{
+		"push": {
+			ExtractRule: map[string]string{
+				"repo":    "repository.full_name",
+				"ref":     "ref",
+				"pusher":  "pusher.login",
+				"count":   "commits.#",
+				"compare": "compare_url",
+			},
+			Filter:  "$count > 0",
+			Title:   `[{{ .vars.repo }}] {{ .vars.pusher }} 推送了 {{ .vars.count }} 个提交到 {{ .vars.ref | trimPrefix "refs/heads/" }}`,
+			Content: presetPushCommits,
+			URL:     `{{ .vars.compare }}`,
+		},
+		"pull_request":  githubPullRequestEvent,
+		"issues":        githubIssuesEvent,
+		"issue_comment": githubIssueCommentEvent,
+		"release":       githubReleaseEvent,
+	},
+}
+
+var gitlabPreset = &WebhookPreset{
+	Name:         "gitlab",
+	Label:        "GitLab",
+	EventHeader:  "X-Gitlab-Event",
+	VerifyScheme: common.WebhookVerifySchemeGitLab,
+	Events: map[string]*WebhookPresetEvent{
+		"Push Hook": {
+			ExtractRule: map[string]string{
+				"repo":  "project.path_with_namespace",
+				"ref":   "ref",
+				"user":  "user_name",
+				"count": "total_commits_count",
+				"url":   "project.web_url",
+			},
+			Filter:  "$count > 0",
+			Title:   `[{{ .vars.repo }}] {{ .vars.user }} 推送了 {{ .vars.count }} 个提交到 {{ .vars.ref | trimPrefix "refs/heads/" }}`,
+			Content: presetPushCommits,
+			URL:     `{{ .vars.url }}/-/commits/{{ .vars.ref | trimPrefix "refs/heads/" }}`,
+		},
+		"Tag Push Hook": {
+			ExtractRule: map[string]string{
+				"repo":  "project.path_with_namespace",
+				"ref":   "ref",
+				"user":  "user_name",
+				"after": "after",
+				"url":   "project.web_url",
+			},
+			// Tag deletions
+			Filter: "$after != '0000000000000000000000000000000000000000'",
+			Title:  `[{{ .vars.repo }}] {{ .vars.user }} 创建了标签 {{ .vars.ref | trimPrefix "refs/tags/" }}`,
+			URL:    `{{ .vars.url }}/-/tags/{{ .vars.ref | trimPrefix "refs/tags/" }}`,
+		},
+		"Merge Request Hook": {
+			ExtractRule: map[string]string{
+				"repo":   "project.path_with_namespace",
+				"action": "object_attributes.action",
+				"number": "object_attributes.iid",
+				"title":  "object_attributes.title",
+				"body":   "object_attributes.description",
+				"user":   "user.name",
+				"url":    "object_attributes.url",
+				"source": "object_attributes.source_branch",
+				"target": "object_attributes.target_branch",
+			},
+			Filter: "$action in [open, close, reopen, merge]",
+			Title: `[{{ .vars.repo }}] {{ .vars.user }} ` +
+				`{{ if eq .vars.action "merge" }}合并了{{ else if eq .vars.action "close" }}关闭了` +
+				`{{ else if eq .vars.action "reopen" }}重新打开了{{ else }}创建了{{ end }} MR !{{ .vars.number }}`,
+			Description: `{{ .vars.title }}`,
+			Content:     presetChangeBody + `{{ "\n\n" }}{{ .vars.source }} → {{ .vars.target }}`,
+			URL:         `{{ .vars.url }}`,
+		},
+		"Issue Hook": {
+			ExtractRule: map[string]string{
+				"repo":   "project.path_with_namespace",
+				"action": "object_attributes.action",
+				"number": "object_attributes.iid",
+				"title":  "object_attributes.title",
+				"body":   "object_attributes.description",
+				"user":   "user.name",
+				"url":    "object_attributes.url",
+			},
+			Filter: "$action in [open, close, reopen]",
+			Title: `[{{ .vars.repo }}] {{ .vars.user }} ` +
+				`{{ if eq .vars.action "close" }}关闭了{{ else if eq .vars.action "reopen" }}重新打开了{{ else }}创建了{{ end }}` +
+				` Issue #{{ .vars.number }}`,
+			Description: `{{ .vars.title }}`,
+			Content:     presetChangeBody,
+			URL:         `{{ .vars.url }}`,
+		},
+		"Note Hook": {
+			ExtractRule: map[string]string{
+				"repo":        "project.path_with_namespace",
+				"user":        "user.name",
+				"body":        "object_attributes.note",
+				"url":         "object_attributes.url",
+				"mr":          "merge_request.iid",
+				"mr_title":    "merge_request.title",
+				"issue":       "issue.iid",
+				"issue_title": "issue.title",
+			},
+			Title: `[{{ .vars.repo }}] {{ .vars.user }} 评论了` +
+				`{{ if .vars.mr }} MR !{{ .vars.mr }}{{ else if .vars.issue }} Issue #{{ .vars.issue }}{{ end }}`,
+			Description: `{{ .vars.mr_title | default .vars.issue_title }}`,
+			Content:     `{{ .vars.body | truncate 500 }}`,
+			URL:         `{{ .vars.url }}`,
+		},
+		"Pipeline Hook": {
+			ExtractRule: map[string]string{
+				"repo":     "project.path_with_namespace",
+				"id":       "object_attributes.id",
+				"status":   "object_attributes.status",
+				"ref":      "object_attributes.ref",
+				"duration": "object_attributes.duration",
+				"user":     "user.name",
+				"url":      "project.web_url",
+			},
+			Filter: "$status in [success, failed, canceled]",
+			Title: `[{{ .vars.repo }}] 流水线 #{{ .vars.id }} ` +
+				`{{ if eq .vars.status "success" }}运行成功{{ else if eq .vars.status "failed" }}运行失败{{ else }}已取消{{ end }}`,
+			Description: `分支 {{ .vars.ref }}，由 {{ .vars.user }} 触发{{ with .vars.duration }}，耗时 {{ . }} 秒{{ end }}`,
+			URL:         `{{ .vars.url }}/-/pipelines/{{ .vars.id }}`,
+		},
+	},
+}
+
+// grafanaPreset supports the webhook contact point of Grafana Alerting, as well as legacy alerting.
+var grafanaPreset = &WebhookPreset{
+	Name:         "grafana",
+	Label:        "Grafana",
+	VerifyScheme: common.WebhookVerifySchemeBearer,
+	Events: map[string]*WebhookPresetEvent{
+		"": {
+			ExtractRule: map[string]string{
+				"status":   "status",
+				"title":    "title",
+				"message":  "message",
+				"summary":  "commonAnnotations.summary",
+				"url":      "externalURL",
+				"rule":     "ruleName",
+				"rule_url": "ruleUrl",
+			},
+			Title:       `{{ .vars.title | default .vars.rule }}`,
+			Description: `{{ .vars.summary }}`,
+			Content: `{{ with .body.alerts }}{{ range . }}` +
+				`- **{{ with .labels }}{{ .alertname }}{{ end }}**（{{ if eq .status "resolved" }}已恢复{{ else }}告警{{ end }}）` +
+				`{{ with .annotations }}{{ with .summary }}：{{ . }}{{ end }}{{ end }}` +
+				`{{ with .startsAt }}，开始于 {{ date "2006-01-02 15:04:05" . }}{{ end }}{{ "\n" }}` +
+				`{{ end }}{{ else }}{{ .vars.message }}{{ end }}`,
+			URL: `{{ .vars.url | default .vars.rule_url }}`,
+		},
+	},
+}
+
+// sentryPreset supports Sentry's internal integrations, requests without Sentry-Hook-Resource are
+// handled as the legacy webhooks plugin.
+var sentryPreset = &WebhookPreset{
+	Name:            "sentry",
+	Label:           "Sentry",
+	EventHeader:     "Sentry-Hook-Resource",
+	VerifyScheme:    common.WebhookVerifySchemeHMAC,
+	SignatureHeader: "Sentry-Hook-Signature",
+	Events: map[string]*WebhookPresetEvent{
+		"": {
+			ExtractRule: map[string]string{
+				"project": "project_name",
+				"level":   "level",
+				"message": "message",
+				"title":   "event.title",
+				"culprit": "culprit",
+				"url":     "url",
+			},
+			Title:       `[{{ .vars.project }}][{{ .vars.level }}] {{ .vars.title | default .vars.message }}`,
+			Description: `{{ .vars.culprit }}`,
+			URL:         `{{ .vars.url }}`,
+		},
+		"event_alert": {
+			ExtractRule: map[string]string{
+				"title":   "data.event.title",
+				"level":   "data.event.level",
+				"culprit": "data.event.culprit",
+				"rule":    "data.triggered_rule",
+				"url":     "data.event.web_url",
+			},
+			Title:       `[Sentry][{{ .vars.level }}] {{ .vars.title }}`,
+			Description: `{{ .vars.culprit }}`,
+			Content:     `- 告警规则：{{ .vars.rule }}{{ with .vars.culprit }}{{ "\n" }}- 位置：{{ . }}{{ end }}`,
+			URL:         `{{ .vars.url }}`,
+		},
+		"issue": {
+			ExtractRule: map[string]string{
+				"action":    "action",
+				"title":     "data.issue.title",
+				"short_id":  "data.issue.shortId",
+				"culprit":   "data.issue.culprit",
+				"url":       "data.issue.web_url",
+				"permalink": "data.issue.permalink",
+			},
+			Filter: "$action in [created, resolved, unresolved]",
+			Title: `[Sentry] {{ .vars.short_id }} ` +
+				`{{ if eq .vars.action "resolved" }}已解决{{ else if eq .vars.action "unresolved" }}重新出现{{ else }}新问题{{ end }}` +
+				`：{{ .vars.title }}`,
+			Description: `{{ .vars.culprit }}`,
+			URL:         `{{ .vars.url | default .vars.permalink }}`,
+		},
+		"metric_alert": {
+			ExtractRule: map[string]string{
+				"action": "action",
+				"title":  "data.description_title",
+				"text":   "data.description_text",
+				"url":    "data.web_url",
+			},
+			Title:       `[Sentry][{{ if eq .vars.action "resolved" }}已恢复{{ else }}{{ .vars.action }}{{ end }}] {{ .vars.title }}`,
+			Description: `{{ .vars.text }}`,
+			URL:         `{{ .vars.url }}`,
+		},
+		"error": {
+			ExtractRule: map[string]string{
+				"title":   "data.error.title",
+				"level":   "data.error.level",
+				"culprit": "data.error.culprit",
+				"url":     "data.error.web_url",
+			},
+			Title:       `[Sentry][{{ .vars.level }}] {{ .vars.title }}`,
+			Description: `{{ .vars.culprit }}`,
+			URL:         `{{ .vars.url }}`,
+		},
+	},
+}
+
+var WebhookPresets = map[string]*WebhookPreset{
+	githubPreset.Name:  githubPreset,
+	gitlabPreset.Name:  gitlabPreset,
+	giteaPreset.Name:   giteaPreset,
+	grafanaPreset.Name: grafanaPreset,
+	sentryPreset.Name:  sentryPreset,
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"errors"
+)
+
+// WebhookRequestLogMaxLimit is the max number of requests a webhook can keep.
+const WebhookRequestLogMaxLimit = 100
+
+// WebhookEndpointAlertmanager is the endpoint of requests received from Alertmanager, see WebhookRequest.Endpoint.
+const WebhookEndpointAlertmanager = "alertmanager"
+
+// WebhookRequest records a request received by a webhook, so that it can be inspected and replayed.
+type WebhookRequest struct {
+	Id          int               `json:"id"`
+	WebhookId   int               `json:"webhook_id" gorm:"index"`
+	Headers     map[string]string `json:"headers" gorm:"type:text;serializer:json"` // credentials are redacted
+	Query       string            `json:"query"`                                    // raw query string
+	Body        string            `json:"body" gorm:"type:text"`
+	Truncated   bool              `json:"truncated"`                                  // the body is too large to be stored in full
+	Variables   map[string]string `json:"variables" gorm:"type:text;serializer:json"` // extracted by the webhook's extract rule
+	MessageLink string            `json:"message_link" gorm:"type:varchar(32)"`
+	Error       string            `json:"error"`
+	Skipped     bool              `json:"skipped"`                          // the request didn't match the webhook's filter
+	ReplayOf    int               `json:"replay_of"`                        // id of the replayed request, 0 if it's a real request
+	Endpoint    string            `json:"endpoint" gorm:"type:varchar(16)"` // empty for the generic endpoint
+	CreatedTime int64             `json:"created_time" gorm:"bigint"`
+}
+
+func GetWebhookRequestsByWebhookId(webhookId int, startIdx int, num int) (requests []*WebhookRequest, err error) {
+	err = DB.Where("webhook_id = ?", webhookId).Order("id desc").Limit(num).Offset(startIdx).Find(&requests).Error
+	return requests, err
+}
+
+func GetWebhookRequestById(id int, webhookId int) (*WebhookRequest, error) {
+	if id == 0 || webhookId == 0 {
+		return nil, errors.New("id 或 webhookId 为空！")
+	}
+	request := WebhookRequest{Id: id, WebhookId: webhookId}
+	err := DB.Where(request).First(&request).Error
+	return &request, err
+}
+
+func DeleteWebhookRequestsByWebhookId(webhookId int) error {
+	return DB.Where("webhook_id = ?", webhookId).Delete(&WebhookRequest{}).Error
+}
+
+// Insert saves the request and drops the requests beyond limit.
+func (request *WebhookRequest) Insert(limit int) error {
+	err := DB.Create(request).Error
+	if err != nil {
+		return err
+	}
+	var ids []int
+	err = DB.Model(&WebhookRequest{}).Where("webhook_id = ?", request.WebhookId).Order("id desc").
+		Offset(limit).Limit(WebhookRequestLogMaxLimit).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return DB.Where("id in ?", ids).Delete(&WebhookRequest{}).Error
+}
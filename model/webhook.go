@@ -15,15 +15,32 @@ type WebhookConstructRule struct {
 }
 
 type Webhook struct {
-	Id            int    `json:"id"`
-	UserId        int    `json:"user_id" gorm:"index"`
-	Name          string `json:"name" gorm:"type:varchar(32);index"`
-	Status        int    `json:"status" gorm:"default:1"` // enabled, disabled
-	Link          string `json:"link" gorm:"type:char(32);uniqueIndex"`
-	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
-	ExtractRule   string `json:"extract_rule" gorm:"not null"`              // how we extract key info from the request
-	ConstructRule string `json:"construct_rule" gorm:"not null"`            // how we construct message with the extracted info
-	Channel       string `json:"channel" gorm:"type:varchar(32); not null"` // which channel to send our message
+	Id              int            `json:"id"`
+	UserId          int            `json:"user_id" gorm:"index"`
+	Name            string         `json:"name" gorm:"type:varchar(32);index"`
+	Status          int            `json:"status" gorm:"default:1"` // enabled, disabled
+	Link            string         `json:"link" gorm:"type:char(32);uniqueIndex"`
+	CreatedTime     int64          `json:"created_time" gorm:"bigint"`
+	ExtractRule     string         `json:"extract_rule" gorm:"not null"`              // how we extract key info from the request
+	ConstructRule   string         `json:"construct_rule" gorm:"not null"`            // how we construct message with the extracted info
+	Channel         string         `json:"channel" gorm:"type:varchar(32); not null"` // which channel to send our message
+	TemplateEnabled bool           `json:"template_enabled"`                          // if true, ConstructRule is a Go text/template instead of $var replacement
+	Filter          string         `json:"filter" gorm:"type:text"`                   // requests not matching the filter are skipped, see common.Filter
+	Routes          []WebhookRoute `json:"routes" gorm:"type:text;serializer:json"`   // the first matched route decides the channel
+	VerifyScheme    string         `json:"verify_scheme" gorm:"type:varchar(16)"`     // how to verify the request's signature, empty means no verification
+	Secret          string         `json:"secret" gorm:"serializer:encrypted"`
+	SignatureHeader string         `json:"signature_header" gorm:"type:varchar(64)"` // for the hmac scheme, X-Signature by default
+	Tolerance       int            `json:"tolerance"`                                // max age of a signed timestamp in seconds, 300 by default
+	LogLimit        int            `json:"log_limit"`                                // how many recent requests to keep, 0 means not recording
+	Preset          string         `json:"preset" gorm:"type:varchar(32)"`           // if set, the preset's rules are used instead of ExtractRule and ConstructRule
+	// set by ApplyPreset, ConstructRule is then a WebhookConstructRule whose fields are rendered as templates one by one
+	FieldTemplates bool `json:"-" gorm:"-:all"`
+}
+
+// WebhookRoute sends the message to Channel instead of the webhook's channel if Condition matches.
+type WebhookRoute struct {
+	Condition string `json:"condition"` // same syntax as Webhook.Filter
+	Channel   string `json:"channel"`
 }
 
 func GetWebhookById(id int, userId int) (*Webhook, error) {
@@ -45,12 +62,12 @@ func GetWebhookByLink(link string) (*Webhook, error) {
 }
 
 func GetWebhooksByUserId(userId int, startIdx int, num int) (webhooks []*Webhook, err error) {
-	err = DB.Where("user_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&webhooks).Error
+	err = DB.Omit("secret").Where("user_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&webhooks).Error
 	return webhooks, err
 }
 
 func SearchWebhooks(userId int, keyword string) (webhooks []*Webhook, err error) {
-	err = DB.Where("user_id = ?", userId).Where("id = ? or link = ? or name LIKE ?", keyword, keyword, keyword+"%").Find(&webhooks).Error
+	err = DB.Omit("secret").Where("user_id = ?", userId).Where("id = ? or link = ? or name LIKE ?", keyword, keyword, keyword+"%").Find(&webhooks).Error
 	return webhooks, err
 }
 
@@ -81,11 +98,15 @@ func (webhook *Webhook) UpdateStatus(status int) error {
 // Update Make sure your token's fields is completed, because this will update zero values
 func (webhook *Webhook) Update() error {
 	var err error
-	err = DB.Model(webhook).Select("status", "name", "extract_rule", "construct_rule", "channel").Updates(webhook).Error
+	err = DB.Model(webhook).Select("status", "name", "extract_rule", "construct_rule", "channel", "template_enabled", "filter", "routes",
+		"verify_scheme", "secret", "signature_header", "tolerance", "log_limit", "preset").Updates(webhook).Error
 	return err
 }
 
 func (webhook *Webhook) Delete() error {
 	err := DB.Delete(webhook).Error
-	return err
+	if err != nil {
+		return err
+	}
+	return DeleteWebhookRequestsByWebhookId(webhook.Id)
 }
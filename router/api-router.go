@@ -55,37 +55,68 @@ func SetApiRouter(router *gin.Engine) {
 			optionRoute.GET("/", controller.GetOptions)
 			optionRoute.PUT("/", controller.UpdateOption)
 		}
+		// Only the resource routes below use ResourceAuth and accept management-scoped API tokens,
+		// routes of accounts, tokens and options require a login session, see docs/API.md
 		messageRoute := apiRouter.Group("/message")
 		{
-			messageRoute.GET("/", middleware.UserAuth(), controller.GetUserMessages)
-			messageRoute.GET("/stream", middleware.UserAuth(), middleware.SetSSEHeaders(), controller.GetNewMessages)
-			messageRoute.GET("/search", middleware.UserAuth(), controller.SearchMessages)
+			messageRoute.GET("/", middleware.ResourceAuth(), controller.GetUserMessages)
+			messageRoute.GET("/stream", middleware.ResourceAuth(), middleware.SetSSEHeaders(), controller.GetNewMessages)
+			messageRoute.GET("/search", middleware.ResourceAuth(), controller.SearchMessages)
 			messageRoute.GET("/status/:link", controller.GetMessageStatus)
-			messageRoute.POST("/resend/:id", middleware.UserAuth(), controller.ResendMessage)
-			messageRoute.GET("/:id", middleware.UserAuth(), controller.GetMessage)
+			messageRoute.POST("/resend/:id", middleware.ResourceAuth(), controller.ResendMessage)
+			messageRoute.GET("/scheduled", middleware.ResourceAuth(), controller.GetScheduledMessages)
+			messageRoute.POST("/reschedule/:id", middleware.ResourceAuth(), controller.RescheduleMessage)
+			messageRoute.POST("/cancel/:id", middleware.ResourceAuth(), controller.CancelScheduledMessage)
+			messageRoute.GET("/:id", middleware.ResourceAuth(), controller.GetMessage)
 			messageRoute.DELETE("/", middleware.RootAuth(), controller.DeleteAllMessages)
-			messageRoute.DELETE("/:id", middleware.UserAuth(), controller.DeleteMessage)
+			messageRoute.DELETE("/:id", middleware.ResourceAuth(), controller.DeleteMessage)
+		}
+		tokenRoute := apiRouter.Group("/token")
+		tokenRoute.Use(middleware.UserAuth())
+		{
+			tokenRoute.GET("/", controller.GetAllApiTokens)
+			tokenRoute.GET("/:id", controller.GetApiToken)
+			tokenRoute.POST("/", controller.AddApiToken)
+			tokenRoute.PUT("/", controller.UpdateApiToken)
+			tokenRoute.DELETE("/:id", controller.DeleteApiToken)
 		}
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.UserAuth())
+		channelRoute.Use(middleware.ResourceAuth())
 		{
 			channelRoute.GET("/", controller.GetAllChannels)
 			channelRoute.GET("/search", controller.SearchChannels)
+			channelRoute.GET("/types", controller.GetChannelTypes)
+			channelRoute.POST("/test/:id", controller.TestChannel)
 			channelRoute.GET("/:id", controller.GetChannel)
 			channelRoute.POST("/", controller.AddChannel)
 			channelRoute.PUT("/", controller.UpdateChannel)
 			channelRoute.DELETE("/:id", controller.DeleteChannel)
 		}
 		webhookRoute := apiRouter.Group("/webhook")
-		webhookRoute.Use(middleware.UserAuth())
+		webhookRoute.Use(middleware.ResourceAuth())
 		{
 			webhookRoute.GET("/", controller.GetAllWebhooks)
 			webhookRoute.GET("/search", controller.SearchWebhooks)
+			webhookRoute.GET("/presets", controller.GetWebhookPresets)
 			webhookRoute.GET("/:id", controller.GetWebhook)
+			webhookRoute.GET("/:id/requests", controller.GetWebhookRequests)
+			webhookRoute.POST("/:id/requests/:request_id/replay", controller.ReplayWebhookRequest)
 			webhookRoute.POST("/", controller.AddWebhook)
+			webhookRoute.POST("/:id/test", controller.TestWebhook)
 			webhookRoute.PUT("/", controller.UpdateWebhook)
 			webhookRoute.DELETE("/:id", controller.DeleteWebhook)
 		}
+		jobRoute := apiRouter.Group("/job")
+		jobRoute.Use(middleware.ResourceAuth())
+		{
+			jobRoute.GET("/", controller.GetAllScheduledJobs)
+			jobRoute.GET("/:id", controller.GetScheduledJob)
+			jobRoute.GET("/:id/runs", controller.GetScheduledJobRuns)
+			jobRoute.POST("/", controller.AddScheduledJob)
+			jobRoute.POST("/:id/run", controller.RunScheduledJob)
+			jobRoute.PUT("/", controller.UpdateScheduledJob)
+			jobRoute.DELETE("/:id", controller.DeleteScheduledJob)
+		}
 	}
 	pushRouter := router.Group("/push")
 	pushRouter.Use(middleware.GlobalAPIRateLimit())
@@ -97,5 +128,6 @@ func SetApiRouter(router *gin.Engine) {
 	webhookRouter.Use(middleware.GlobalAPIRateLimit())
 	{
 		webhookRouter.POST("/:link", controller.TriggerWebhook)
+		webhookRouter.POST("/:link/alertmanager", controller.TriggerAlertmanagerWebhook)
 	}
 }